@@ -34,6 +34,11 @@ DIST_IDS="$(echo "$ID $ID_LIKE" | tr ' ' ',')"
 case ",$DIST_IDS," in
     *,arch,*)   exec /usr/lib/holo/holo-build --pacman "$@" ;;
     *,debian,*) exec /usr/lib/holo/holo-build --debian "$@" ;;
+    *,alpine,*)
+        echo "!! Running on Alpine Linux, but holo-build cannot build apk packages yet." >&2
+        echo ">> Select another package format explicitly with --debian or --pacman." >&2
+        exit 1
+        ;;
     *)
         echo "!! Running on an unrecognized distribution. Distribution IDs: $DIST_IDS" >&2
         echo ">> Please report this error at <https://github.com/holocm/holo-build/issues/new>" >&2
@@ -23,8 +23,11 @@ package common
 //This file needs to be in an extra package to break an import cycle.
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
@@ -49,16 +52,29 @@ func IsFileInfoASymbolicLink(fileInfo os.FileInfo) bool {
 	return (fileInfo.Mode() & os.ModeType) == os.ModeSymlink
 }
 
-//CopyFile copies a regular file or symlink, including the file metadata.
+//CopyFile copies a regular file or symlink, including the file metadata. The
+//copy is written into a temporary file first, and then moved into place, so
+//that toPath always contains either the old or the complete new file.
 func CopyFile(fromPath, toPath string) error {
 	info, err := os.Lstat(fromPath)
 	if err != nil {
 		return err
 	}
+	tempPath := toPath + ".holonew"
 	if info.Mode().IsRegular() {
-		return copyFileImpl(fromPath, toPath)
+		err = copyFileImpl(fromPath, tempPath)
+	} else {
+		err = copySymlinkImpl(fromPath, tempPath)
 	}
-	return copySymlinkImpl(fromPath, toPath)
+	if err != nil {
+		_ = os.Remove(tempPath) //this can fail silently
+		return err
+	}
+	err = os.Rename(tempPath, toPath)
+	if err != nil {
+		return err
+	}
+	return SyncDirectory(filepath.Dir(toPath))
 }
 
 func copyFileImpl(fromPath, toPath string) error {
@@ -67,7 +83,11 @@ func copyFileImpl(fromPath, toPath string) error {
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(toPath, data, 0600)
+	err = os.Remove(toPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = WriteFileSynced(toPath, data, 0600)
 	if err != nil {
 		return err
 	}
@@ -82,19 +102,12 @@ func copySymlinkImpl(fromPath, toPath string) error {
 		return err
 	}
 	//remove old file or link if it exists
-	if IsManageableFile(toPath) {
-		err = os.Remove(toPath)
-		if err != nil {
-			return err
-		}
-	}
-	//create new link
-	err = os.Symlink(target, toPath)
-	if err != nil {
+	err = os.Remove(toPath)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-
-	return nil
+	//create new link
+	return os.Symlink(target, toPath)
 }
 
 //MoveFile is like CopyFile, but it removes the fromPath after successful
@@ -107,10 +120,11 @@ func MoveFile(fromPath, toPath string) error {
 	return os.Remove(fromPath)
 }
 
-//ApplyFilePermissions applies permission flags and ownership
-//from the first file to the second file.
+//ApplyFilePermissions applies permission flags, ownership and extended
+//attributes (e.g. ACLs or SELinux contexts) from the first file to the second
+//file.
 func ApplyFilePermissions(fromPath, toPath string) error {
-	//apply permissions, ownership, modification date from source file to target file
+	//apply permissions, ownership and extended attributes from source file to target file
 	//NOTE: We cannot just pass the FileMode in WriteFile(), because its
 	//FileMode argument is only applied when a new file is created, not when
 	//an existing one is truncated.
@@ -124,15 +138,22 @@ func ApplyFilePermissions(fromPath, toPath string) error {
 	}
 
 	if !IsFileInfoASymbolicLink(targetInfo) {
+		//apply ownership (this needs to happen first since chown clears the
+		//setuid and setgid bits and file capabilities)
+		stat := info.Sys().(*syscall.Stat_t) // UGLY
+		err = os.Chown(toPath, int(stat.Uid), int(stat.Gid))
+		if err != nil {
+			return err
+		}
+
 		//apply permissions
 		err = os.Chmod(toPath, info.Mode())
 		if err != nil {
 			return err
 		}
 
-		//apply ownership
-		stat := info.Sys().(*syscall.Stat_t) // UGLY
-		err = os.Chown(toPath, int(stat.Uid), int(stat.Gid))
+		//apply extended attributes
+		err = CopyExtendedAttributes(fromPath, toPath)
 		if err != nil {
 			return err
 		}
@@ -140,3 +161,95 @@ func ApplyFilePermissions(fromPath, toPath string) error {
 
 	return nil
 }
+
+//PruneEmptyDirectories removes the parent directories of the given path for as
+//long as they are empty, up to (but excluding) the given root directory.
+func PruneEmptyDirectories(path, rootDir string) error {
+	prefix := filepath.Clean(rootDir) + string(filepath.Separator)
+	for dir := filepath.Dir(filepath.Clean(path)); strings.HasPrefix(dir, prefix); dir = filepath.Dir(dir) {
+		isEmpty, err := IsEmptyDirectory(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if !isEmpty {
+			return nil
+		}
+		err = os.Remove(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//IsEmptyDirectory returns whether the given directory has no entries.
+func IsEmptyDirectory(path string) (bool, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return len(names) == 0, nil
+}
+
+//WriteFileSynced works like ioutil.WriteFile, but flushes the file contents to
+//disk before returning.
+func WriteFileSynced(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+//SyncDirectory flushes the entries of the given directory to disk, so that
+//files that were created, renamed or removed in it stay that way after a
+//crash.
+func SyncDirectory(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	closeErr := dir.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+//WriteFileAtomically writes a regular file with mode 0644 by writing into a
+//temporary file first, and then moving it into place. Missing parent
+//directories are created.
+func WriteFileAtomically(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".holonew"
+	err = WriteFileSynced(tempPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return err
+	}
+	return SyncDirectory(dir)
+}
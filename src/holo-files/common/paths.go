@@ -20,42 +20,61 @@
 
 package common
 
-import (
-	"os"
-	"strings"
-)
-
-var (
-	targetDirectory   string
-	stateDirectory    string
-	resourceDirectory string
-)
-
-func init() {
-	targetDirectory = strings.TrimSuffix(os.Getenv("HOLO_ROOT_DIR"), "/")
-	if targetDirectory == "" {
-		targetDirectory = "/"
-	}
-	stateDirectory = strings.TrimSuffix(os.Getenv("HOLO_STATE_DIR"), "/")
-	resourceDirectory = strings.TrimSuffix(os.Getenv("HOLO_RESOURCE_DIR"), "/")
+import "../../lib/holo"
+
+//TargetBaseDirectory is $HOLO_STATE_DIR/base.
+func TargetBaseDirectory() string {
+	return holo.StateDirectory() + "/base"
 }
 
-//TargetDirectory is $HOLO_ROOT_DIR (or "/" if not set).
-func TargetDirectory() string {
-	return targetDirectory
+//ProvisionedDirectory is $HOLO_STATE_DIR/provisioned.
+func ProvisionedDirectory() string {
+	return holo.StateDirectory() + "/provisioned"
 }
 
-//ResourceDirectory is $HOLO_RESOURCE_DIR.
-func ResourceDirectory() string {
-	return resourceDirectory
+//CreatedDirectory is $HOLO_STATE_DIR/created. It contains an empty file for
+//each target that was created by Holo.
+func CreatedDirectory() string {
+	return holo.StateDirectory() + "/created"
 }
 
-//TargetBaseDirectory is $HOLO_STATE_DIR/base.
-func TargetBaseDirectory() string {
-	return stateDirectory + "/base"
+//DeletedDirectory is $HOLO_STATE_DIR/deleted. It contains an empty file for
+//each target that was deleted by Holo.
+func DeletedDirectory() string {
+	return holo.StateDirectory() + "/deleted"
 }
 
-//ProvisionedDirectory is $HOLO_STATE_DIR/provisioned.
-func ProvisionedDirectory() string {
-	return stateDirectory + "/provisioned"
+//AdoptedDirectory is $HOLO_STATE_DIR/adopted. For each target that was adopted
+//by `holo adopt`, it contains the result of applying the repository entries at
+//the time of adoption.
+func AdoptedDirectory() string {
+	return holo.StateDirectory() + "/adopted"
+}
+
+//JournalDirectory is $HOLO_STATE_DIR/journal. While the changes to a target
+//and its state files are being made, it contains a journal entry that lists
+//these changes (see impl.transaction).
+func JournalDirectory() string {
+	return holo.StateDirectory() + "/journal"
+}
+
+//GenerationsDirectory is $HOLO_STATE_DIR/generations. For each target, it
+//contains a directory with the earlier generations of the provisioned copy
+//(see impl.generation).
+func GenerationsDirectory() string {
+	return holo.StateDirectory() + "/generations"
+}
+
+//StateDirectories returns all the directories below $HOLO_STATE_DIR that
+//mirror the target directory.
+func StateDirectories() []string {
+	return []string{
+		TargetBaseDirectory(),
+		ProvisionedDirectory(),
+		CreatedDirectory(),
+		DeletedDirectory(),
+		AdoptedDirectory(),
+		JournalDirectory(),
+		GenerationsDirectory(),
+	}
 }
@@ -0,0 +1,157 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+//CopyExtendedAttributes copies all extended attributes (including POSIX ACLs,
+//SELinux contexts and file capabilities) from the first file to the second
+//file, and removes the extended attributes of the second file that the first
+//file does not have (except for those in the "security" namespace, which are
+//managed by the kernel and security modules). Symlinks are skipped.
+func CopyExtendedAttributes(fromPath, toPath string) error {
+	for _, path := range []string{fromPath, toPath} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if IsFileInfoASymbolicLink(info) {
+			return nil
+		}
+	}
+
+	//when the source does not support extended attributes, it does not have
+	//any that could be copied
+	fromAttrs := make(map[string][]byte)
+	fromNames, err := listExtendedAttributes(fromPath)
+	if err != nil && err != syscall.ENOTSUP {
+		return fmt.Errorf("cannot read extended attributes of %s: %s", fromPath, err.Error())
+	}
+	for _, name := range fromNames {
+		value, err := getExtendedAttribute(fromPath, name)
+		if err != nil {
+			return fmt.Errorf("cannot read extended attribute %s of %s: %s", name, fromPath, err.Error())
+		}
+		fromAttrs[name] = value
+	}
+	toNames, err := listExtendedAttributes(toPath)
+	if err != nil && err != syscall.ENOTSUP {
+		return fmt.Errorf("cannot read extended attributes of %s: %s", toPath, err.Error())
+	}
+
+	//remove attributes that the source does not have (attributes like
+	//"security.selinux" or "security.ima" are set by the kernel for each new
+	//file, and cannot or must not be removed)
+	for _, name := range toNames {
+		if _, exists := fromAttrs[name]; exists || strings.HasPrefix(name, "security.") {
+			continue
+		}
+		err := syscall.Removexattr(toPath, name)
+		if err != nil && err != syscall.ENODATA {
+			return fmt.Errorf("cannot remove extended attribute %s from %s: %s", name, toPath, err.Error())
+		}
+	}
+
+	//copy all other attributes
+	for _, name := range fromNames {
+		err := syscall.Setxattr(toPath, name, fromAttrs[name], 0)
+		if err == syscall.ENOTSUP {
+			return fmt.Errorf("cannot copy extended attribute %s from %s to %s: filesystem does not support extended attributes", name, fromPath, toPath)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot copy extended attribute %s from %s to %s: %s", name, fromPath, toPath, err.Error())
+		}
+	}
+	return nil
+}
+
+//listExtendedAttributes returns the names of all extended attributes of the
+//given file, in sorted order.
+func listExtendedAttributes(path string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		size, err = syscall.Listxattr(path, buf)
+		if err == syscall.ERANGE {
+			//the list has grown in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		//the list contains NUL-terminated names
+		names := strings.Split(strings.TrimSuffix(string(buf[:size]), "\x00"), "\x00")
+		sort.Strings(names)
+		return names, nil
+	}
+}
+
+//getExtendedAttribute returns the value of an extended attribute of the given
+//file.
+func getExtendedAttribute(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil || size == 0 {
+			return []byte{}, err
+		}
+		buf := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, buf)
+		if err == syscall.ERANGE {
+			//the value has grown in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
+
+//capabilityAttribute is the extended attribute that holds file capabilities.
+const capabilityAttribute = "security.capability"
+
+//Lchown works like os.Lchown, but keeps the file capabilities of the file
+//(which are cleared by the kernel when the ownership changes).
+func Lchown(path string, uid, gid int) error {
+	capabilities, err := getExtendedAttribute(path, capabilityAttribute)
+	if err != nil {
+		//the file has no capabilities (or the filesystem does not support them)
+		capabilities = nil
+	}
+	err = os.Lchown(path, uid, gid)
+	if err != nil || capabilities == nil {
+		return err
+	}
+	err = syscall.Setxattr(path, capabilityAttribute, capabilities, 0)
+	if err != nil {
+		return fmt.Errorf("cannot restore file capabilities of %s: %s", path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"../../lib/holo"
+	"../common"
+)
+
+//Adopt records the current state of the target as its provisioned state (see
+//"holo adopt"). If exportDir is not empty, a repository entry that turns the
+//desired state into the current state is written into it: either a file that
+//replaces the target, or a .holopatch file if asPatch is true.
+func (target *TargetFile) Adopt(exportDir string, asPatch bool) error {
+	targetPath := target.PathIn(holo.TargetDirectory())
+	if target.orphaned {
+		return errors.New("cannot adopt target: all repository files were deleted")
+	}
+	if !common.IsManageableFile(targetPath) {
+		return errors.New("cannot adopt target: not a manageable file")
+	}
+	if !common.IsManageableFile(target.PathIn(common.TargetBaseDirectory())) {
+		return errors.New("cannot adopt target: target has not been provisioned yet")
+	}
+
+	//compare the current state to the desired state
+	buffer, err := target.render()
+	if err != nil {
+		return err
+	}
+	if buffer.Absent {
+		return errors.New("cannot adopt target: target is deleted by a repository file")
+	}
+	targetBuffer, err := NewFileBuffer(targetPath, targetPath)
+	if err != nil {
+		return err
+	}
+	if targetBuffer.EqualTo(buffer) {
+		fmt.Println(">> target is already in the desired state, nothing to adopt")
+		return nil
+	}
+
+	//export first, so that nothing is recorded when the export fails
+	if exportDir != "" {
+		err = target.export(exportDir, asPatch, buffer, targetBuffer)
+		if err != nil {
+			return err
+		}
+	}
+
+	//record the current state as the provisioned state, so that it does not
+	//count as modified by the user anymore
+	tx := target.newTransaction()
+	defer tx.abort()
+	err = tx.writeFile(target.PathIn(common.ProvisionedDirectory()), targetBuffer, func(tempPath string) error {
+		return common.ApplyFilePermissions(targetPath, tempPath)
+	})
+	if err != nil {
+		return err
+	}
+
+	//remember the desired state at the time of adoption; the adopted state is
+	//kept until the desired state changes
+	err = tx.writeFile(target.PathIn(common.AdoptedDirectory()), buffer, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.commit()
+	if err != nil {
+		return err
+	}
+	fmt.Println(">> recorded current state as provisioned state")
+	return nil
+}
+
+//export writes a repository entry into the given directory that turns the
+//desired state into the current state of the target.
+func (target *TargetFile) export(exportDir string, asPatch bool, desired, current *FileBuffer) error {
+	exportPath := filepath.Join(exportDir, target.relTargetPath)
+	exported := current
+	if asPatch {
+		exportPath += ".holopatch"
+		//patches can only express changes between text files
+		if current.SymlinkTarget != "" {
+			return errors.New("cannot export as patch: target is a symlink")
+		}
+		desired, err := desired.ResolveSymlink()
+		if err != nil {
+			return err
+		}
+		if isBinary(desired.Contents) || isBinary(current.Contents) {
+			return errors.New("cannot export as patch: target is a binary file")
+		}
+		var out bytes.Buffer
+		writeFileDiff(&out, target.relTargetPath,
+			diffFile{mode: "100644", contents: desired.Contents},
+			diffFile{mode: "100644", contents: current.Contents},
+		)
+		exported = NewFileBufferFromContents(out.Bytes(), exportPath)
+	}
+
+	err := os.MkdirAll(filepath.Dir(exportPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = exported.Write(exportPath)
+	if err != nil {
+		return err
+	}
+	if exported.SymlinkTarget == "" {
+		err = os.Chmod(exportPath, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf(">> exported to %s\n", exportPath)
+	return nil
+}
+
+//adoptedBuffer returns the desired state of the target at the time when it
+//was adopted, or nil if the target was not adopted.
+func (target *TargetFile) adoptedBuffer() (*FileBuffer, error) {
+	adoptedPath := target.PathIn(common.AdoptedDirectory())
+	if !common.IsManageableFile(adoptedPath) {
+		return nil, nil
+	}
+	return NewFileBuffer(adoptedPath, target.PathIn(holo.TargetDirectory()))
+}
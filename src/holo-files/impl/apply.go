@@ -25,7 +25,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
+	"../../lib/holo"
 	"../common"
 	"../platform"
 )
@@ -34,22 +37,37 @@ import (
 //This includes taking a copy of the target base if necessary, applying all
 //repository entries, and saving the result in the target path with the correct
 //file metadata.
-func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
+func apply(target *TargetFile, withForce, withMerge bool) (skipReport bool, err error) {
 	//determine the related paths
-	targetPath := target.PathIn(common.TargetDirectory())
+	targetPath := target.PathIn(holo.TargetDirectory())
 	targetBasePath := target.PathIn(common.TargetBaseDirectory())
 
+	//read the metadata (mode and ownership of the target etc.)
+	meta, err := target.Meta()
+	if err != nil {
+		return false, err
+	}
+
 	//step 1: will only apply targets if:
 	//option 1: there is a manageable file in the target location (this target
 	//file is either the target base from the application package or the
 	//product of a previous Apply run)
 	//option 2: the target file was deleted, but we have a target base that we
 	//can start from
+	//option 3: neither exists, but the metadata requests that the target be
+	//created (with an empty target base)
+	//(if the target was deleted by a `.holodelete` repo file, the target base
+	//is used without complaining about the missing target)
 	if !common.IsManageableFile(targetPath) {
 		if !common.IsManageableFile(targetBasePath) {
-			return false, errors.New("skipping target: not a manageable file")
-		}
-		if !withForce {
+			if !meta.Create {
+				return false, errors.New("skipping target: not a manageable file")
+			}
+			err = target.createTargetBase(meta)
+			if err != nil {
+				return false, fmt.Errorf("Cannot create target base %s: %s", targetBasePath, err.Error())
+			}
+		} else if !withForce && !target.wasDeleted() {
 			return false, errors.New("skipping target: file has been deleted by user (use --force to restore)")
 		}
 	}
@@ -77,7 +95,7 @@ func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
 	}
 	if updatedTBPath != "" {
 		//an updated stock configuration is available at updatedTBPath
-		fmt.Printf(">> found updated target base: %s -> %s", reportedTBPath, targetBasePath)
+		fmt.Printf(">> found updated target base: %s -> %s\n", reportedTBPath, targetBasePath)
 		err := common.CopyFile(updatedTBPath, targetBasePath)
 		if err != nil {
 			return false, fmt.Errorf("Cannot copy %s to %s: %s", updatedTBPath, targetBasePath, err.Error())
@@ -88,9 +106,15 @@ func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
 	//step 4: apply the repo files *if* the version at targetPath is the one
 	//installed by the package (which can be found at targetBasePath); complain if
 	//the user made any changes to config files governed by holo (this check is
-	//overridden by the --force option)
-	var lastProvisionedBuffer *FileBuffer
+	//overridden by the --force option; with the --merge option, the changes are
+	//merged into the result instead)
+	var lastProvisionedBuffer, userBuffer *FileBuffer
 	lastProvisionedPath := target.PathIn(common.ProvisionedDirectory())
+	//a target that was deleted by Holo has no provisioned copy, but when it has
+	//been recreated since (by the user or a package), it counts as modified
+	if !withForce && target.wasDeleted() && common.IsManageableFile(targetPath) {
+		return false, errors.New("skipping target: file has been recreated after it was deleted (use --force to overwrite)")
+	}
 	if !withForce && common.IsManageableFile(lastProvisionedPath) {
 		targetBuffer, err := NewFileBuffer(targetPath, targetPath)
 		if err != nil {
@@ -101,10 +125,184 @@ func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
 			return false, err
 		}
 		if !targetBuffer.EqualTo(lastProvisionedBuffer) {
-			return false, errors.New("skipping target: file has been modified by user (use --force to overwrite)")
+			if !withMerge {
+				return false, errors.New("skipping target: file has been modified by user (use --force to overwrite or --merge to merge)")
+			}
+			userBuffer = targetBuffer
+		}
+		//the mode and ownership are only checked if they are managed by the
+		//metadata (otherwise they are copied from the target base anyway)
+		differ, err := meta.attributesDiffer(targetPath, lastProvisionedPath)
+		if err != nil {
+			return false, err
+		}
+		if differ {
+			return false, errors.New("skipping target: file mode or ownership has been modified by user (use --force to overwrite)")
 		}
 	}
 
+	//apply all repository entries to the target base
+	buffer, err := target.render()
+	if err != nil {
+		return false, err
+	}
+
+	//targets adopted by `holo adopt` keep their current state until the result
+	//of the repository entries changes
+	keepAdoption := false
+	if !withForce && lastProvisionedBuffer != nil {
+		adoptedBuffer, err := target.adoptedBuffer()
+		if err != nil {
+			return false, err
+		}
+		if adoptedBuffer != nil && buffer.EqualTo(adoptedBuffer) {
+			buffer = lastProvisionedBuffer
+			keepAdoption = true
+		}
+	}
+
+	//if the result is "no file", delete the target and its provisioned copy,
+	//but keep the target base to restore the target when the deletion is no
+	//longer requested
+	if buffer.Absent {
+		if userBuffer != nil {
+			return false, errors.New("cannot merge changes by user: target is deleted by a repository file")
+		}
+		if !withForce && target.wasDeleted() && !common.IsManageableFile(targetPath) {
+			//since we did not do anything, don't report this
+			return true, nil
+		}
+		tx := target.newTransaction()
+		defer tx.abort()
+		err = tx.removeFile(targetPath)
+		if err == nil {
+			err = tx.removeFile(lastProvisionedPath)
+		}
+		if err == nil {
+			err = tx.removeFile(target.PathIn(common.AdoptedDirectory()))
+		}
+		if err == nil {
+			err = tx.createFile(target.PathIn(common.DeletedDirectory()))
+		}
+		if err != nil {
+			return false, err
+		}
+		return false, tx.commit()
+	}
+
+	//don't do anything more if nothing has changed
+	if !withForce && lastProvisionedBuffer != nil {
+		hasAttributes, err := meta.hasAttributes(lastProvisionedPath)
+		if err != nil {
+			return false, err
+		}
+		if buffer.EqualTo(lastProvisionedBuffer) && hasAttributes {
+			//since we did not do anything, don't report this
+			return true, nil
+		}
+	}
+
+	//if the user modified the target, merge these changes into the result
+	//(this is done before writing anything since merging might fail, and
+	//nothing is written when there are conflicts)
+	resultBuffer := buffer
+	if userBuffer != nil {
+		resultBuffer, err = mergeBuffers(lastProvisionedBuffer, userBuffer, buffer)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	//write the result buffer to the target location and copy
+	//owners/permissions from target base to target file, unless the metadata
+	//requests different ones; then check the result with the validators
+	//before anything is replaced
+	tx := target.newTransaction()
+	defer tx.abort()
+	err = tx.writeFile(targetPath, resultBuffer, target.prepareNewTarget(meta, resultBuffer))
+	if err != nil {
+		return false, err
+	}
+
+	//save a copy of the provisioned config file to check for manual
+	//modifications in the next Apply() run
+	prepareProvisioned := target.prepareNewProvisionedCopy(meta)
+	err = tx.writeFile(lastProvisionedPath, buffer, prepareProvisioned)
+	if err != nil {
+		return false, err
+	}
+
+	//keep the provisioned copy around as a generation for `holo rollback`
+	err = target.recordGeneration(tx, buffer, meta.KeptGenerations(), prepareProvisioned)
+	if err != nil {
+		return false, err
+	}
+
+	//the target is neither deleted nor adopted anymore
+	err = tx.removeFile(target.PathIn(common.DeletedDirectory()))
+	if err == nil && !keepAdoption {
+		err = tx.removeFile(target.PathIn(common.AdoptedDirectory()))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	//move all files into place (see transaction for how this ensures that the
+	//target and the provisioned copy stay consistent when Holo is interrupted)
+	return false, tx.commit()
+}
+
+//prepareNewTarget returns a function that prepares the temporary file with
+//the given new contents of the target before it replaces the target: The
+//owners/permissions are copied from the target base, unless the metadata
+//requests different ones, and the result is checked with the validators.
+func (target *TargetFile) prepareNewTarget(meta TargetMeta, buffer *FileBuffer) func(string) error {
+	targetPath := target.PathIn(holo.TargetDirectory())
+	targetBasePath := target.PathIn(common.TargetBaseDirectory())
+	return func(newTargetPath string) error {
+		err := common.ApplyFilePermissions(targetBasePath, newTargetPath)
+		if err != nil {
+			return err
+		}
+		err = meta.applyAttributes(newTargetPath)
+		if err != nil {
+			return err
+		}
+		err = target.validate(newTargetPath, meta)
+		if err != nil || !meta.PreserveMtime {
+			return err
+		}
+		return preserveTimes(targetPath, newTargetPath, buffer)
+	}
+}
+
+//prepareNewProvisionedCopy is like prepareNewTarget, but for the provisioned
+//copy (and generations), which are not validated.
+func (target *TargetFile) prepareNewProvisionedCopy(meta TargetMeta) func(string) error {
+	targetBasePath := target.PathIn(common.TargetBaseDirectory())
+	return func(newProvisionedPath string) error {
+		err := common.ApplyFilePermissions(targetBasePath, newProvisionedPath)
+		if err != nil {
+			return err
+		}
+		return meta.applyAttributes(newProvisionedPath)
+	}
+}
+
+//render applies all repository entries of this target to its target base, and
+//returns the result (i.e. the desired state of the target).
+func (target *TargetFile) render() (*FileBuffer, error) {
+	targetPath := target.PathIn(holo.TargetDirectory())
+	targetBasePath := target.PathIn(common.TargetBaseDirectory())
+	meta, err := target.Meta()
+	if err != nil {
+		return nil, err
+	}
+	scriptTimeout, err := meta.ScriptTimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+
 	//check if we can skip any application steps (firstStep = -1 means: start
 	//with loading the target base and apply all steps, firstStep >= 0 means:
 	//start at that application step with an empty buffer)
@@ -122,7 +320,7 @@ func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
 	if firstStep == -1 {
 		buffer, err = NewFileBuffer(targetBasePath, targetPath)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 	} else {
 		buffer = NewFileBufferFromContents([]byte(nil), targetPath)
@@ -130,52 +328,46 @@ func apply(target *TargetFile, withForce bool) (skipReport bool, err error) {
 
 	//apply all the applicable repo files in order (starting from the first one
 	//that matters)
-	if firstStep > 0 {
-		repoEntries = repoEntries[firstStep:]
+	if firstStep < 0 {
+		firstStep = 0
 	}
-	for _, repoFile := range repoEntries {
-		buffer, err = GetApplyImpl(repoFile)(buffer)
+	for idx := firstStep; idx < len(repoEntries); idx++ {
+		repoFile := repoEntries[idx]
+		if buffer.Absent && !repoFile.DiscardsPreviousBuffer() {
+			return nil, fmt.Errorf("cannot apply %s: target was deleted by a previous repository file", repoFile.Path())
+		}
+		buffer, err = GetApplyImpl(repoFile, ApplyContext{
+			Target:        target,
+			StepIndex:     idx,
+			PreviousSteps: repoEntries[firstStep:idx],
+			ScriptTimeout: scriptTimeout,
+		})(buffer)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 	}
 
-	//don't do anything more if nothing has changed
-	if !withForce && lastProvisionedBuffer != nil {
-		if buffer.EqualTo(lastProvisionedBuffer) {
-			//since we did not do anything, don't report this
-			return true, nil
-		}
-	}
+	return buffer, nil
+}
 
-	//save a copy of the provisioned config file to check for manual
-	//modifications in the next Apply() run
-	provisionedDir := filepath.Dir(lastProvisionedPath)
-	err = os.MkdirAll(provisionedDir, 0755)
-	if err != nil {
-		return false, fmt.Errorf("Cannot write %s: %s", lastProvisionedPath, err.Error())
-	}
-	err = buffer.Write(lastProvisionedPath)
-	if err != nil {
-		return false, err
+//preserveTimes copies the access and modification times from the old target
+//to the new target if the new target has the same contents.
+func preserveTimes(targetPath, newTargetPath string, newBuffer *FileBuffer) error {
+	if newBuffer.SymlinkTarget != "" || !common.IsManageableFile(targetPath) {
+		return nil
 	}
-	err = common.ApplyFilePermissions(targetBasePath, lastProvisionedPath)
+	oldBuffer, err := NewFileBuffer(targetPath, targetPath)
 	if err != nil {
-		return false, err
+		return err
 	}
-
-	//write the result buffer to the target location and copy
-	//owners/permissions from target base to target file
-	newTargetPath := targetPath + ".holonew"
-	err = buffer.Write(newTargetPath)
-	if err != nil {
-		return false, err
+	if oldBuffer.SymlinkTarget != "" || !oldBuffer.EqualTo(newBuffer) {
+		return nil
 	}
-	err = common.ApplyFilePermissions(targetBasePath, newTargetPath)
+	info, err := os.Lstat(targetPath)
 	if err != nil {
-		return false, err
+		return err
 	}
-	//move $target.holonew -> $target atomically (to ensure that there is
-	//always a valid file at $target)
-	return false, os.Rename(newTargetPath, targetPath)
+	stat := info.Sys().(*syscall.Stat_t)
+	atime := time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+	return os.Chtimes(newTargetPath, atime, info.ModTime())
 }
@@ -23,8 +23,18 @@ package impl
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"../../lib/holo"
+	"../common"
 )
 
 //The stuff in this file used to be inside src/holo/apply.go, but it was split
@@ -33,13 +43,46 @@ import (
 //ApplyImpl is the return type for GetApplyImpl.
 type ApplyImpl func(*FileBuffer) (*FileBuffer, error)
 
+//ApplyContext describes where an application step stands in the `holo apply`
+//algorithm. It is passed to holoscripts through environment variables (see
+//applyScript).
+type ApplyContext struct {
+	Target *TargetFile
+	//index of the repo file in Target.RepoEntries()
+	StepIndex int
+	//repo files that have been applied before this step (if empty, the buffer
+	//contains the target base)
+	PreviousSteps []RepoFile
+	//maximum runtime of holoscripts (0 means no limit)
+	ScriptTimeout time.Duration
+}
+
 //GetApplyImpl returns a function that applies the given RepoFile to a file
 //buffer, as part of the `holo apply` algorithm.
-func GetApplyImpl(repoFile RepoFile) ApplyImpl {
+func GetApplyImpl(repoFile RepoFile, ctx ApplyContext) ApplyImpl {
 	var impl func(RepoFile, *FileBuffer) (*FileBuffer, error)
-	if repoFile.ApplicationStrategy() == "passthru" {
-		impl = applyScript
-	} else {
+	switch repoFile.ApplicationStrategy() {
+	case "passthru":
+		impl = func(repoFile RepoFile, fb *FileBuffer) (*FileBuffer, error) {
+			return applyScript(repoFile, fb, ctx)
+		}
+	case "template":
+		impl = applyTemplate
+	case "patch":
+		impl = applyPatch
+	case "ini":
+		impl = applyIni
+	case "json":
+		impl = applyJSON
+	case "lines":
+		impl = applyLines
+	case "append":
+		impl = applyAppend
+	case "prepend":
+		impl = applyPrepend
+	case "delete":
+		impl = applyDelete
+	default:
 		impl = applyFile
 	}
 	return func(fb *FileBuffer) (*FileBuffer, error) {
@@ -54,21 +97,151 @@ func applyFile(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
 	return NewFileBuffer(repoFile.Path(), buffer.BasePath)
 }
 
-func applyScript(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+//reportOutput shows the output of an external command (if any) as part of the
+//report for the current target.
+func reportOutput(header string, output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	fmt.Printf(">> %s:\n", header)
+	for _, line := range strings.Split(strings.TrimSuffix(string(output), "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+//runWithTimeout runs the given command. If it takes longer than the given
+//timeout (unless 0), its process group is killed.
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	if timeout == 0 {
+		return cmd.Run()
+	}
+
+	//the output is collected here instead of in cmd.Wait(), so that the script
+	//is only reaped when all processes writing into its output are gone; until
+	//then, its process group ID cannot be reused and it is safe to kill it
+	var copying sync.WaitGroup
+	var files []*os.File
+	for _, output := range []*io.Writer{&cmd.Stdout, &cmd.Stderr} {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			for _, file := range files {
+				_ = file.Close()
+			}
+			return err
+		}
+		defer reader.Close()
+		files = append(files, writer)
+		copying.Add(1)
+		go func(output io.Writer, reader *os.File) {
+			defer copying.Done()
+			_, _ = io.Copy(output, reader)
+		}(*output, reader)
+		*output = writer
+	}
+	err := cmd.Start()
+	//the writing ends are only needed by the script
+	for _, file := range files {
+		_ = file.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	var (
+		mutex    sync.Mutex
+		reaped   bool
+		timedOut bool
+	)
+	timer := time.AfterFunc(timeout, func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !reaped {
+			timedOut = true
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	})
+
+	waitErr := waitUntilExited(cmd.Process.Pid)
+	copying.Wait()
+	mutex.Lock()
+	reaped = true
+	mutex.Unlock()
+	timer.Stop()
+
+	err = cmd.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	//a script that exits successfully just before the timer fires was not
+	//timed out
+	if timedOut && err != nil {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+//waitUntilExited blocks until the given child process has exited, but leaves
+//it waitable (i.e. does not reap it).
+func waitUntilExited(pid int) error {
+	//siginfo_t is 128 bytes on Linux
+	var siginfo [128]byte
+	const pPID = 1 //P_PID from <sys/wait.h>
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(pid),
+			uintptr(unsafe.Pointer(&siginfo)), syscall.WEXITED|syscall.WNOWAIT, 0, 0)
+		if errno != syscall.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
+
+func applyScript(repoFile RepoFile, buffer *FileBuffer, ctx ApplyContext) (*FileBuffer, error) {
 	//this application strategy requires file contents
 	buffer, err := buffer.ResolveSymlink()
 	if err != nil {
 		return nil, err
 	}
 
+	//tell the script where it stands
+	previousSteps := make([]string, 0, len(ctx.PreviousSteps))
+	for _, step := range ctx.PreviousSteps {
+		previousSteps = append(previousSteps, step.Path())
+	}
+	inputIsTargetBase := "false"
+	if len(ctx.PreviousSteps) == 0 {
+		inputIsTargetBase = "true"
+	}
+	env := append(os.Environ(),
+		"HOLO_TARGET_PATH="+ctx.Target.PathIn(holo.TargetDirectory()),
+		"HOLO_TARGET_BASE_PATH="+ctx.Target.PathIn(common.TargetBaseDirectory()),
+		"HOLO_REPO_FILE="+repoFile.Path(),
+		"HOLO_STEP_INDEX="+strconv.Itoa(ctx.StepIndex),
+		"HOLO_PREVIOUS_STEPS="+strings.Join(previousSteps, "\n"),
+		"HOLO_INPUT_IS_TARGET_BASE="+inputIsTargetBase,
+	)
+
 	//run command, fetch result file into buffer (not into the targetPath
 	//directly, in order not to corrupt the file there if the script run fails)
-	var stdout bytes.Buffer
+	var stdout, stderr bytes.Buffer
 	cmd := exec.Command(repoFile.Path())
 	cmd.Stdin = bytes.NewBuffer(buffer.Contents)
 	cmd.Stdout = &stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	cmd.Stderr = &stderr
+	cmd.Env = env
+	if ctx.ScriptTimeout > 0 {
+		//run the script in its own process group, so that a timeout also kills
+		//the processes started by it (which might hold on to stdout); this is
+		//only done when necessary since it takes the script out of the
+		//terminal's foreground process group (so Ctrl-C would not reach it)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	err = runWithTimeout(cmd, ctx.ScriptTimeout)
+
+	//show the script's stderr as part of the report for this target
+	reportOutput("output of "+repoFile.Path()+" on stderr", stderr.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("execution of %s failed: %s", repoFile.Path(), err.Error())
 	}
@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"../../internal/toml"
+	"../../lib/holo"
+)
+
+//The result of the scan operation is cached in $HOLO_CACHE_DIR, so that the
+//other operations do not have to walk over the whole repository again.
+
+type cache struct {
+	RepoDirectories []RepoDirectory
+	Targets         []cachedTarget
+}
+
+type cachedTarget struct {
+	Path        string
+	Orphaned    bool
+	RepoEntries []string
+	MetaFiles   []string
+	Validators  []string
+}
+
+func pathToCacheFile() string {
+	return filepath.Join(holo.CacheDirectory(), "entities.toml")
+}
+
+//StoreCache implements the holo.CachingPlugin interface.
+func (p *FilesPlugin) StoreCache(entities []holo.Entity) error {
+	data := cache{RepoDirectories: p.repoDirs}
+	for _, entity := range entities {
+		target := entity.(*TargetFile)
+		entry := cachedTarget{Path: target.relTargetPath, Orphaned: target.orphaned}
+		for _, repoFile := range target.repoEntries {
+			entry.RepoEntries = append(entry.RepoEntries, repoFile.Path())
+		}
+		entry.MetaFiles = target.metaFiles
+		entry.Validators = target.validators
+		data.Targets = append(data.Targets, entry)
+	}
+
+	file, err := os.Create(pathToCacheFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return toml.NewEncoder(file).Encode(&data)
+}
+
+//LoadCache implements the holo.CachingPlugin interface. If the cache is
+//missing, or if the repository has changed since the scan, nil is returned to
+//request a fresh scan.
+func (p *FilesPlugin) LoadCache() ([]holo.Entity, error) {
+	blob, err := ioutil.ReadFile(pathToCacheFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var data cache
+	_, err = toml.Decode(string(blob), &data)
+	if err != nil {
+		return nil, err
+	}
+
+	//check if the cache is stale
+	for _, dir := range data.RepoDirectories {
+		info, err := os.Stat(dir.Path)
+		if err != nil || info.ModTime().UnixNano() != dir.ModTime {
+			return nil, nil
+		}
+	}
+
+	entities := make([]holo.Entity, 0, len(data.Targets))
+	for _, entry := range data.Targets {
+		target := &TargetFile{relTargetPath: entry.Path, orphaned: entry.Orphaned}
+		for _, path := range entry.RepoEntries {
+			target.AddRepoEntry(NewRepoFile(path))
+		}
+		for _, path := range entry.MetaFiles {
+			target.AddMetaFile(path)
+		}
+		for _, path := range entry.Validators {
+			target.AddValidator(path)
+		}
+		entities = append(entities, target)
+	}
+	return entities, nil
+}
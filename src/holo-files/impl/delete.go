@@ -0,0 +1,45 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"os"
+
+	"../common"
+)
+
+func applyDelete(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//the result is "no file", regardless of the previous buffer
+	return NewAbsentFileBuffer(buffer.BasePath), nil
+}
+
+//deletesTarget returns whether applying this target results in the target
+//being deleted.
+func (target *TargetFile) deletesTarget() bool {
+	entries := target.RepoEntries()
+	return len(entries) > 0 && entries[len(entries)-1].ApplicationStrategy() == "delete"
+}
+
+//wasDeleted returns whether the target was deleted by Holo.
+func (target *TargetFile) wasDeleted() bool {
+	_, err := os.Lstat(target.PathIn(common.DeletedDirectory()))
+	return err == nil
+}
@@ -23,102 +23,190 @@ package impl
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"os/exec"
-	"regexp"
 	"strings"
-	"syscall"
 
+	"../../lib/holo"
 	"../common"
 )
 
-type fileType int
-
-const (
-	fileUnknown fileType = 0
-	fileMissing fileType = 1
-	fileRegular fileType = 2
-	fileSymlink fileType = 3
-)
+//diffFile is one side of a diff: the contents of a regular file or the target
+//of a symlink, along with its mode in the notation used by git-diff(1).
+type diffFile struct {
+	//one of "100644", "100755", "120000" (symlink), or "" (missing file)
+	mode     string
+	contents []byte
+}
 
 //RenderDiff creates a unified diff of a target file and its last provisioned
 //version, similar to `diff /var/lib/holo/files/provisioned/$FILE $FILE`, but it also
 //handles symlinks and missing files gracefully. The output is always a patch
 //that can be applied to last provisioned version into the current version.
 func (target *TargetFile) RenderDiff() ([]byte, error) {
-	fromPath := target.PathIn(common.ProvisionedDirectory())
-	toPath := target.PathIn(common.TargetDirectory())
+	toPath := target.PathIn(holo.TargetDirectory())
 
-	fromPathToUse, err := checkFile(fromPath)
+	from, err := readDiffFile(target.PathIn(common.ProvisionedDirectory()))
 	if err != nil {
 		return nil, err
 	}
-	toPathToUse, err := checkFile(toPath)
+	to, err := readDiffFile(toPath)
 	if err != nil {
 		return nil, err
 	}
 
-	//run git-diff to obtain the diff
-	var buffer bytes.Buffer
-	cmd := exec.Command("git", "diff", "--no-index", "--", fromPathToUse, toPathToUse)
-	cmd.Stdout = &buffer
-	cmd.Stderr = os.Stderr
-
-	//error "exit code 1" is normal for different files, only exit code > 2 means trouble
-	err = cmd.Run()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == 1 {
-					err = nil
-				}
+	//for targets that are deleted by a `.holodelete` repo file, show the whole
+	//file (or its target base, if it was already deleted) as removed
+	if target.deletesTarget() {
+		if to.mode == "" {
+			from, err = readDiffFile(target.PathIn(common.TargetBaseDirectory()))
+			if err != nil {
+				return nil, err
 			}
+		} else {
+			from = to
 		}
+		to = diffFile{}
 	}
-	//did a relevant error occur?
+
+	//the diff always refers to the target path (not to the provisioned path)
+	var out bytes.Buffer
+	name := strings.TrimPrefix(toPath, "/")
+	if from.mode != "" && to.mode != "" && from.isSymlink() != to.isSymlink() {
+		//when the file type changes, show the removal of the old file and the
+		//creation of the new file (like git-diff(1) does)
+		writeFileDiff(&out, name, from, diffFile{})
+		writeFileDiff(&out, name, diffFile{}, to)
+	} else {
+		writeFileDiff(&out, name, from, to)
+	}
+	return out.Bytes(), nil
+}
+
+func readDiffFile(path string) (diffFile, error) {
+	//check that files are either non-existent (in which case the diff shows
+	//"/dev/null" instead) or manageable (e.g. we can't diff directories or
+	//device files)
+	info, err := os.Lstat(path)
 	if err != nil {
-		return nil, err
+		if os.IsNotExist(err) {
+			return diffFile{}, nil
+		}
+		return diffFile{}, err
+	}
+	if !common.IsManageableFileInfo(info) {
+		return diffFile{}, fmt.Errorf("%s is not a manageable file", path)
 	}
 
-	//remove "index <SHA1>..<SHA1> <mode>" lines
-	result := buffer.Bytes()
-	rx := regexp.MustCompile(`(?m:^index .*$)\n`)
-	result = rx.ReplaceAll(result, nil)
+	//symlinks are represented by their target
+	if common.IsFileInfoASymbolicLink(info) {
+		linkTarget, err := os.Readlink(path)
+		return diffFile{mode: "120000", contents: []byte(linkTarget)}, err
+	}
 
-	//remove "/var/lib/holo/files/provisioned" from path displays to make it appear like we
-	//just diff the target path
-	if fromPathToUse == fromPath {
-		fromPathQuoted := strings.TrimPrefix(regexp.QuoteMeta(fromPath), "/")
-		toPathQuoted := strings.TrimPrefix(regexp.QuoteMeta(toPath), "/")
-		toPathTrimmed := strings.TrimPrefix(toPath, "/")
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return diffFile{}, err
+	}
+	if info.Mode()&0111 != 0 {
+		return diffFile{mode: "100755", contents: contents}, nil
+	}
+	return diffFile{mode: "100644", contents: contents}, nil
+}
 
-		rx = regexp.MustCompile(`(?m:^)diff --git a/` + fromPathQuoted)
-		result = rx.ReplaceAll(result, []byte("diff --git a/"+toPathTrimmed))
+func (f diffFile) isSymlink() bool {
+	return f.mode == "120000"
+}
 
-		rx = regexp.MustCompile(`(?m:^)diff --git a/` + toPathQuoted + ` b/` + fromPathQuoted)
-		result = rx.ReplaceAll(result, []byte("diff --git a/"+toPathTrimmed+" b/"+toPathTrimmed))
+//writeFileDiff writes a diff between the two versions of the file with the
+//given name, in the format of git-diff(1).
+func writeFileDiff(out *bytes.Buffer, name string, from, to diffFile) {
+	//nothing to show?
+	if from.mode == to.mode && bytes.Equal(from.contents, to.contents) {
+		return
+	}
 
-		rx = regexp.MustCompile(`(?m:^)--- a/` + fromPathQuoted)
-		result = rx.ReplaceAll(result, []byte("--- a/"+toPathTrimmed))
+	fromLabel, toLabel := quotePath("a/"+name), quotePath("b/"+name)
+	fmt.Fprintf(out, "diff --git %s %s\n", fromLabel, toLabel)
+	switch {
+	case from.mode == "":
+		fmt.Fprintf(out, "new file mode %s\n", to.mode)
+		fromLabel = "/dev/null"
+	case to.mode == "":
+		fmt.Fprintf(out, "deleted file mode %s\n", from.mode)
+		toLabel = "/dev/null"
+	case from.mode != to.mode:
+		fmt.Fprintf(out, "old mode %s\nnew mode %s\n", from.mode, to.mode)
 	}
 
-	return result, nil
+	//for a change of mode only (or for empty files), the header is enough
+	if bytes.Equal(from.contents, to.contents) {
+		return
+	}
+	if isBinary(from.contents) || isBinary(to.contents) {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", fromLabel, toLabel)
+		return
+	}
+
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	writeHunks(out, diffLines(splitLines(string(from.contents)), splitLines(string(to.contents))))
 }
 
-func checkFile(path string) (pathToUse string, returnError error) {
-	//check that files are either non-existent (in which case git-diff needs to
-	//be given /dev/null instead or manageable (e.g. we can't diff directories
-	//or device files)
-	info, err := os.Lstat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "/dev/null", nil
+//isBinary uses the same heuristic as git-diff(1): Files with a NUL byte in
+//the first 8000 bytes are binary.
+func isBinary(contents []byte) bool {
+	if len(contents) > 8000 {
+		contents = contents[:8000]
+	}
+	return bytes.IndexByte(contents, 0) >= 0
+}
+
+//quotePath quotes a path for display in a diff header if it contains special
+//characters, in the same way as git-diff(1) does.
+func quotePath(path string) string {
+	needsQuoting := false
+	for idx := 0; idx < len(path); idx++ {
+		c := path[idx]
+		if c < 0x20 || c >= 0x7F || c == '"' || c == '\\' {
+			needsQuoting = true
+			break
 		}
-		return path, err
+	}
+	if !needsQuoting {
+		return path
 	}
 
-	if !common.IsManageableFileInfo(info) {
-		return path, fmt.Errorf("%s is not a manageable file", path)
+	var result bytes.Buffer
+	result.WriteByte('"')
+	for idx := 0; idx < len(path); idx++ {
+		c := path[idx]
+		switch c {
+		case '\a':
+			result.WriteString(`\a`)
+		case '\b':
+			result.WriteString(`\b`)
+		case '\t':
+			result.WriteString(`\t`)
+		case '\n':
+			result.WriteString(`\n`)
+		case '\v':
+			result.WriteString(`\v`)
+		case '\f':
+			result.WriteString(`\f`)
+		case '\r':
+			result.WriteString(`\r`)
+		case '"':
+			result.WriteString(`\"`)
+		case '\\':
+			result.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7F {
+				fmt.Fprintf(&result, `\%03o`, c)
+			} else {
+				result.WriteByte(c)
+			}
+		}
 	}
-	return path, nil
+	result.WriteByte('"')
+	return result.String()
 }
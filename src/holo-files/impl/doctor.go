@@ -0,0 +1,188 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"../../lib/holo"
+	"../common"
+)
+
+//Doctor implements the holo.DoctorPlugin interface.
+func (p *FilesPlugin) Doctor(entities []holo.Entity, withRepair bool) (healthy bool) {
+	healthy = true
+	problem := func(repair func() error, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if repair == nil {
+			fmt.Printf("!! %s\n", msg)
+			healthy = false
+			return
+		}
+		if !withRepair {
+			fmt.Printf("!! %s (use --repair to fix)\n", msg)
+			healthy = false
+			return
+		}
+		err := repair()
+		if err != nil {
+			fmt.Printf("!! %s (repair failed: %s)\n", msg, err.Error())
+			healthy = false
+			return
+		}
+		fmt.Printf(">> repaired: %s\n", msg)
+	}
+
+	//interrupted transactions are completed by the next `holo apply` (this
+	//needs to happen first, since the journal refers to temporary files)
+	for _, journalPath := range pendingJournals() {
+		journalPath := journalPath
+		problem(func() error {
+			changes, err := parseJournal(journalPath)
+			if err != nil {
+				return err
+			}
+			return replayJournal(journalPath, changes)
+		}, "journal entry %s was left behind by an interrupted `holo apply`", journalPath)
+	}
+
+	for _, entity := range entities {
+		target := entity.(*TargetFile)
+		if target.orphaned {
+			problem(nil, "target base %s belongs to a target that is no longer managed (use `holo apply %s` to scrub it)",
+				target.PathIn(common.TargetBaseDirectory()), target.EntityID())
+		}
+	}
+
+	//an interrupted transaction may leave temporary files behind (the journal
+	//has been replayed above, so all remaining ones are unused)
+	for _, tempPath := range strayTemporaryFiles(entities) {
+		tempPath := tempPath
+		problem(func() error { return os.Remove(tempPath) },
+			"stray temporary file %s", tempPath)
+	}
+
+	//every provisioned copy needs a target base
+	provisionedDir := common.ProvisionedDirectory()
+	filepath.Walk(provisionedDir, func(provisionedPath string, info os.FileInfo, err error) error {
+		if err != nil || !common.IsManageableFileInfo(info) || strings.HasSuffix(provisionedPath, ".holonew") {
+			return nil
+		}
+		target := NewTargetFileFromPathIn(provisionedDir, provisionedPath)
+		if !common.IsManageableFile(target.PathIn(common.TargetBaseDirectory())) {
+			problem(func() error { return os.Remove(provisionedPath) },
+				"provisioned copy %s has no target base", provisionedPath)
+		}
+		return nil
+	})
+
+	//empty directories are left behind when all files below them are removed
+	//(older versions of Holo did not remove them after scrubbing)
+	for _, stateDir := range common.StateDirectories() {
+		for _, dir := range emptyDirectories(stateDir) {
+			dir := dir
+			problem(func() error { return os.Remove(dir) },
+				"empty directory %s", dir)
+		}
+	}
+
+	return healthy
+}
+
+//strayTemporaryFiles returns all temporary files below the state directories,
+//and next to all targets that are either known as entities or mentioned in
+//the state directories (which covers targets whose repository entries have
+//been removed since).
+func strayTemporaryFiles(entities []holo.Entity) []string {
+	isStray := make(map[string]bool)
+	targetPaths := make(map[string]bool)
+	for _, entity := range entities {
+		targetPaths[entity.(*TargetFile).PathIn(holo.TargetDirectory())] = true
+	}
+
+	for _, stateDir := range common.StateDirectories() {
+		stateDir := stateDir
+		filepath.Walk(stateDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			if strings.HasSuffix(path, ".holonew") {
+				isStray[path] = true
+				return nil
+			}
+			//generations are stored in a directory named like the target
+			//(e.g. "$HOLO_STATE_DIR/generations/etc/foo.conf/1")
+			if stateDir == common.GenerationsDirectory() {
+				path = filepath.Dir(path)
+			}
+			relPath, err := filepath.Rel(stateDir, path)
+			if err == nil && relPath != "." {
+				targetPaths[filepath.Join(holo.TargetDirectory(), relPath)] = true
+			}
+			return nil
+		})
+	}
+
+	for targetPath := range targetPaths {
+		tempPath := targetPath + ".holonew"
+		if _, err := os.Lstat(tempPath); err == nil {
+			isStray[tempPath] = true
+		}
+	}
+
+	result := make([]string, 0, len(isStray))
+	for path := range isStray {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//emptyDirectories returns all directories below the given directory that
+//contain nothing but other empty directories. Subdirectories are listed before
+//their parents, so they can be removed in this order.
+func emptyDirectories(rootDir string) []string {
+	var result []string
+	var visit func(dir string) (isEmpty bool)
+	visit = func(dir string) bool {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		isEmpty := true
+		for _, entry := range entries {
+			if !entry.IsDir() || !visit(filepath.Join(dir, entry.Name())) {
+				isEmpty = false
+			}
+		}
+		if isEmpty && dir != rootDir {
+			result = append(result, dir)
+		}
+		return isEmpty
+	}
+	visit(rootDir)
+	return result
+}
@@ -39,6 +39,8 @@ type FileBuffer struct {
 	SymlinkTarget string
 	//used by ResolveSymlink (see doc over there)
 	BasePath string
+	//set if the file shall not exist (see NewAbsentFileBuffer)
+	Absent bool
 }
 
 //NewFileBuffer creates a FileBuffer object by reading the manageable file at
@@ -95,6 +97,21 @@ func NewFileBufferFromContents(fileContents []byte, basePath string) *FileBuffer
 	}
 }
 
+//NewAbsentFileBuffer creates a file buffer which indicates that the file shall
+//not exist. The basePath is stored in the FileBuffer for use in
+//holo.FileBuffer.ResolveSymlink().
+func NewAbsentFileBuffer(basePath string) *FileBuffer {
+	return &FileBuffer{
+		Contents:      nil,
+		SymlinkTarget: "",
+		BasePath:      basePath,
+		Absent:        true,
+	}
+}
+
+//Write replaces the file at the given path with the contents of this buffer
+//(or removes it, for absent buffers). Regular files are flushed to disk before
+//Write returns.
 func (fb *FileBuffer) Write(path string) error {
 	//(check that we're not attempting to overwrite unmanageable files
 	info, err := os.Lstat(path)
@@ -117,10 +134,14 @@ func (fb *FileBuffer) Write(path string) error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	//for absent buffers, that's all
+	if fb.Absent {
+		return nil
+	}
 
 	//a manageable file is either a regular file...
 	if fb.Contents != nil {
-		return ioutil.WriteFile(path, fb.Contents, 600)
+		return common.WriteFileSynced(path, fb.Contents, 0600)
 	}
 	//...or a symlink
 	return os.Symlink(fb.SymlinkTarget, path)
@@ -140,6 +161,9 @@ func (fb *FileBuffer) ResolveSymlink() (*FileBuffer, error) {
 	if fb.Contents != nil {
 		return fb, nil
 	}
+	if fb.Absent {
+		return nil, errors.New("file was deleted by a previous application step")
+	}
 
 	//if the symlink target is relative, resolve it
 	target := fb.SymlinkTarget
@@ -161,6 +185,9 @@ func (fb *FileBuffer) ResolveSymlink() (*FileBuffer, error) {
 
 //EqualTo returns whether two file buffers have the same content (or link target).
 func (fb *FileBuffer) EqualTo(other *FileBuffer) bool {
+	if fb.Absent || other.Absent {
+		return fb.Absent == other.Absent
+	}
 	if fb.Contents != nil {
 		return bytes.Equal(fb.Contents, other.Contents)
 	}
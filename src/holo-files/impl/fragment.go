@@ -0,0 +1,95 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"../../lib/holo"
+)
+
+//markerDeclaration is the first line of a `.holoappend` or `.holoprepend`
+//repo file that requests marker comments, e.g. "# holo: markers". The part
+//before it is the comment leader for the marker comments.
+const markerDeclaration = "holo: markers"
+
+func applyAppend(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	return applyFragment(repoFile, buffer, false)
+}
+
+func applyPrepend(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	return applyFragment(repoFile, buffer, true)
+}
+
+func applyFragment(repoFile RepoFile, buffer *FileBuffer, prepend bool) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	fragment, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	fragment = wrapFragment(repoFile, fragment)
+
+	var result bytes.Buffer
+	if prepend {
+		result.Write(fragment)
+		result.Write(buffer.Contents)
+	} else {
+		result.Write(buffer.Contents)
+		if len(buffer.Contents) > 0 && !bytes.HasSuffix(buffer.Contents, []byte("\n")) {
+			result.WriteByte('\n')
+		}
+		result.Write(fragment)
+	}
+	return NewFileBufferFromContents(result.Bytes(), buffer.BasePath), nil
+}
+
+//wrapFragment wraps the fragment in marker comments if the fragment requests
+//this with a marker declaration. The result always ends with a newline.
+func wrapFragment(repoFile RepoFile, fragment []byte) []byte {
+	if len(fragment) > 0 && !bytes.HasSuffix(fragment, []byte("\n")) {
+		fragment = append(fragment, '\n')
+	}
+
+	split := bytes.SplitN(fragment, []byte("\n"), 2)
+	firstLine := strings.TrimSpace(string(split[0]))
+	if !strings.HasSuffix(firstLine, markerDeclaration) {
+		return fragment
+	}
+	leader := strings.TrimSuffix(firstLine, markerDeclaration)
+
+	//the markers name the repo file relative to the resource directory
+	//(e.g. "20-foo/etc/sudoers.holoappend"), which identifies the package
+	name, _ := filepath.Rel(holo.ResourceDirectory(), repoFile.Path())
+
+	var result bytes.Buffer
+	result.WriteString(leader + "BEGIN " + name + "\n")
+	result.Write(split[1])
+	result.WriteString(leader + "END " + name + "\n")
+	return result.Bytes()
+}
@@ -0,0 +1,168 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"../../internal/toml"
+	"../common"
+)
+
+//defaultGenerations is the number of generations of the provisioned file that
+//are kept when the metadata does not say otherwise.
+const defaultGenerations = 5
+
+//generation describes an earlier version of the provisioned copy of a target.
+//For each generation, the directory $HOLO_STATE_DIR/generations/$target
+//contains a copy of the provisioned file named after the generation's ID
+//(e.g. "3"), and a file with the generation's info (e.g. "3.toml").
+type generation struct {
+	ID        int       `toml:"-"`
+	Timestamp time.Time `toml:"timestamp"`
+	RepoFiles []string  `toml:"repo_files"`
+}
+
+func (target *TargetFile) generationsPath() string {
+	return target.PathIn(common.GenerationsDirectory())
+}
+
+//contentsPath returns the path to the copy of the provisioned file for this
+//generation.
+func (gen generation) contentsPath(target *TargetFile) string {
+	return filepath.Join(target.generationsPath(), strconv.Itoa(gen.ID))
+}
+
+//infoPath returns the path to the info file for this generation.
+func (gen generation) infoPath(target *TargetFile) string {
+	return gen.contentsPath(target) + ".toml"
+}
+
+//generations returns all recorded generations of this target, from oldest to
+//newest.
+func (target *TargetFile) generations() ([]generation, error) {
+	infos, err := ioutil.ReadDir(target.generationsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var result []generation
+	for _, info := range infos {
+		idStr := strings.TrimSuffix(info.Name(), ".toml")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || idStr == info.Name() {
+			//not an info file (or a temporary file)
+			continue
+		}
+		gen := generation{ID: id}
+		blob, err := ioutil.ReadFile(gen.infoPath(target))
+		if err != nil {
+			return nil, err
+		}
+		_, err = toml.Decode(string(blob), &gen)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", gen.infoPath(target), err.Error())
+		}
+		result = append(result, gen)
+	}
+	sort.Sort(generationsByID(result))
+	return result, nil
+}
+
+//recordGeneration adds the given buffer (which is about to become the
+//provisioned copy) as a new generation in the given transaction, and drops
+//generations that exceed the number of generations that shall be kept. The
+//prepare function works like for transaction.writeFile().
+func (target *TargetFile) recordGeneration(tx *transaction, buffer *FileBuffer, keep int, prepare func(tempPath string) error) error {
+	gens, err := target.generations()
+	if err != nil {
+		return err
+	}
+
+	if keep > 0 {
+		//do not record the same contents twice in a row
+		isDuplicate := false
+		nextID := 1
+		if len(gens) > 0 {
+			latest := gens[len(gens)-1]
+			nextID = latest.ID + 1
+			latestBuffer, err := NewFileBuffer(latest.contentsPath(target), buffer.BasePath)
+			isDuplicate = err == nil && latestBuffer.EqualTo(buffer)
+		}
+		if !isDuplicate {
+			gen := generation{
+				ID:        nextID,
+				Timestamp: time.Now().UTC().Truncate(time.Second),
+			}
+			err = target.addGeneration(tx, gen, buffer, prepare)
+			if err != nil {
+				return err
+			}
+			gens = append(gens, gen)
+		}
+	}
+
+	//drop the oldest generations
+	for len(gens) > keep {
+		err = tx.removeFile(gens[0].contentsPath(target))
+		if err == nil {
+			err = tx.removeFile(gens[0].infoPath(target))
+		}
+		if err != nil {
+			return err
+		}
+		gens = gens[1:]
+	}
+	return nil
+}
+
+func (target *TargetFile) addGeneration(tx *transaction, gen generation, buffer *FileBuffer, prepare func(tempPath string) error) error {
+	for _, entry := range target.RepoEntries() {
+		gen.RepoFiles = append(gen.RepoFiles, entry.Path())
+	}
+	var info bytes.Buffer
+	err := toml.NewEncoder(&info).Encode(&gen)
+	if err != nil {
+		return err
+	}
+	err = tx.writeFile(gen.contentsPath(target), buffer, prepare)
+	if err != nil {
+		return err
+	}
+	return tx.writeFile(gen.infoPath(target), NewFileBufferFromContents(info.Bytes(), gen.infoPath(target)), nil)
+}
+
+type generationsByID []generation
+
+func (g generationsByID) Len() int           { return len(g) }
+func (g generationsByID) Less(i, j int) bool { return g[i].ID < g[j].ID }
+func (g generationsByID) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
@@ -0,0 +1,264 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+//iniLine is a single line of an INI file (or a key-value file without
+//sections). The text does not include the line terminator.
+type iniLine struct {
+	text    string
+	section string
+	//set only for lines containing a key (with or without value)
+	key string
+	//set only for section headers
+	isHeader bool
+}
+
+//iniChange describes the changes that a `.holoini` repo file requests for a
+//single key. All keys are set or deleted in the order in which they first
+//appear in the repo file.
+type iniChange struct {
+	section string
+	key     string
+	//the lines (as written in the repo file) that set this key (empty if the
+	//key is deleted)
+	lines  []string
+	delete bool
+}
+
+func applyIni(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parseIniChanges(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", repoFile.Path(), err.Error())
+	}
+
+	text := string(buffer.Contents)
+	lines := parseIniLines(text)
+	for _, change := range changes {
+		lines = change.applyTo(lines)
+	}
+
+	//keep the trailing newline (or its absence) intact
+	result := make([]string, len(lines))
+	for idx, line := range lines {
+		result[idx] = line.text
+	}
+	resultText := strings.Join(result, "\n")
+	if text == "" || strings.HasSuffix(text, "\n") {
+		resultText += "\n"
+	}
+	return NewFileBufferFromContents([]byte(resultText), buffer.BasePath), nil
+}
+
+//parseIniLines splits an INI file into lines, and classifies them.
+func parseIniLines(text string) []iniLine {
+	rawLines := strings.Split(text, "\n")
+	if rawLines[len(rawLines)-1] == "" {
+		rawLines = rawLines[:len(rawLines)-1]
+	}
+
+	lines := make([]iniLine, len(rawLines))
+	section := ""
+	for idx, rawLine := range rawLines {
+		lines[idx].text = rawLine
+		trimmed := strings.TrimSpace(rawLine)
+		switch {
+		case isIniComment(trimmed):
+			//comments and empty lines are kept as they are
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			lines[idx].isHeader = true
+		default:
+			lines[idx].key = iniKey(trimmed)
+		}
+		lines[idx].section = section
+	}
+	return lines
+}
+
+//parseIniChanges parses the contents of a `.holoini` repo file. This is an
+//INI file itself, where each line "key = value" sets the key in the same
+//section, and each line "-key" deletes the key.
+func parseIniChanges(text string) ([]*iniChange, error) {
+	var changes []*iniChange
+	findChange := make(map[string]*iniChange)
+	section := ""
+
+	for idx, rawLine := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(rawLine)
+		if isIniComment(trimmed) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+
+		isDelete := strings.HasPrefix(trimmed, "-")
+		key := iniKey(strings.TrimPrefix(trimmed, "-"))
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", idx+1)
+		}
+		if isDelete && key != strings.TrimSpace(strings.TrimPrefix(trimmed, "-")) {
+			return nil, fmt.Errorf("line %d: cannot give a value when deleting a key", idx+1)
+		}
+
+		//the same key may be given multiple times for multiple values
+		id := section + "\x00" + key
+		change := findChange[id]
+		if change == nil {
+			change = &iniChange{section: section, key: key, delete: isDelete}
+			findChange[id] = change
+			changes = append(changes, change)
+		}
+		if change.delete != isDelete {
+			return nil, fmt.Errorf("line %d: cannot both set and delete %s", idx+1, key)
+		}
+		if !isDelete {
+			change.lines = append(change.lines, trimmed)
+		}
+	}
+
+	return changes, nil
+}
+
+func isIniComment(trimmedLine string) bool {
+	return trimmedLine == "" || trimmedLine[0] == '#' || trimmedLine[0] == ';'
+}
+
+//iniKey returns the key from a line "key = value" or "key".
+func iniKey(trimmedLine string) string {
+	return strings.TrimSpace(strings.SplitN(trimmedLine, "=", 2)[0])
+}
+
+//applyTo applies this change to the given lines.
+func (change *iniChange) applyTo(lines []iniLine) []iniLine {
+	//find existing occurrences of the key, and the extent of the section
+	var occurrences []int
+	sectionExists := change.section == ""
+	//new keys are inserted after a commented-out occurrence of the key, or
+	//else after the last key (or the section header)
+	insertAt, insertAfterComment := 0, -1
+	for idx, line := range lines {
+		if line.section != change.section {
+			continue
+		}
+		if line.key == change.key {
+			occurrences = append(occurrences, idx)
+		}
+		if line.isHeader {
+			sectionExists = true
+		}
+		if line.isHeader || line.key != "" {
+			insertAt = idx + 1
+		}
+		if isCommentedIniKey(line.text, change.key) {
+			insertAfterComment = idx + 1
+		}
+	}
+	if insertAfterComment >= 0 {
+		insertAt = insertAfterComment
+	}
+
+	newLines := make([]iniLine, len(change.lines))
+	for idx, text := range change.lines {
+		newLines[idx] = iniLine{text: text, section: change.section, key: change.key}
+	}
+
+	switch {
+	case len(occurrences) > 0:
+		//replace the first occurrence, keeping its formatting, and remove all
+		//other occurrences
+		template := lines[occurrences[0]].text
+		for idx := range newLines {
+			newLines[idx].text = formatIniLine(template, newLines[idx].text)
+		}
+		var result []iniLine
+		for idx, line := range lines {
+			switch {
+			case idx == occurrences[0]:
+				result = append(result, newLines...)
+			case line.section != change.section || line.key != change.key:
+				result = append(result, line)
+			}
+		}
+		return result
+	case change.delete:
+		//nothing to delete
+		return lines
+	case sectionExists:
+		result := make([]iniLine, 0, len(lines)+len(newLines))
+		result = append(result, lines[:insertAt]...)
+		result = append(result, newLines...)
+		return append(result, lines[insertAt:]...)
+	default:
+		//append a new section at the end of the file
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].text) != "" {
+			lines = append(lines, iniLine{section: lines[len(lines)-1].section})
+		}
+		header := iniLine{text: "[" + change.section + "]", section: change.section, isHeader: true}
+		lines = append(lines, header)
+		return append(lines, newLines...)
+	}
+}
+
+//isCommentedIniKey checks whether the given line is a comment containing the
+//given key, e.g. "#Color" or "; key = value".
+func isCommentedIniKey(text, key string) bool {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || (trimmed[0] != '#' && trimmed[0] != ';') {
+		return false
+	}
+	return iniKey(strings.TrimLeft(trimmed, "#; \t")) == key
+}
+
+//formatIniLine formats the line "key = value" from the repo file in the same
+//way as the existing line in the target (esp. regarding indentation and
+//whitespace around the equal sign).
+func formatIniLine(template, line string) string {
+	indent := template[:len(template)-len(strings.TrimLeft(template, " \t"))]
+	split := strings.SplitN(line, "=", 2)
+	templateSplit := strings.SplitN(strings.TrimSpace(template), "=", 2)
+	if len(split) < 2 || len(templateSplit) < 2 {
+		//key without value on either side: take the line as it is
+		return indent + line
+	}
+
+	//take "key = " from the template, the value from the line
+	value := strings.TrimSpace(split[1])
+	valueIndent := templateSplit[1][:len(templateSplit[1])-len(strings.TrimLeft(templateSplit[1], " \t"))]
+	return indent + templateSplit[0] + "=" + valueIndent + value
+}
@@ -0,0 +1,399 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func applyJSON(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	patch, err := decodeJSON(contents)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", repoFile.Path(), err.Error())
+	}
+	//an empty target is treated like "null"
+	var document interface{}
+	if len(bytes.TrimSpace(buffer.Contents)) > 0 {
+		document, err = decodeJSON(buffer.Contents)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", buffer.BasePath, err.Error())
+		}
+	}
+
+	//an array is a JSON Patch (RFC 6902), anything else is a JSON Merge Patch
+	//(RFC 7386)
+	if operations, ok := patch.([]interface{}); ok {
+		document, err = applyJSONPatch(document, operations)
+		if err != nil {
+			return nil, fmt.Errorf("cannot apply %s to %s: %s", repoFile.Path(), buffer.BasePath, err.Error())
+		}
+	} else {
+		document = applyJSONMergePatch(document, patch)
+	}
+
+	//encoding/json sorts object keys, so the output is deterministic
+	var result bytes.Buffer
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileBufferFromContents(result.Bytes(), buffer.BasePath), nil
+}
+
+//decodeJSON decodes a JSON document while preserving the exact representation
+//of numbers. Syntax errors are reported with a line number.
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result interface{}
+	err := decoder.Decode(&result)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after top-level value")
+	}
+	if err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+//applyJSONMergePatch implements the algorithm from RFC 7386, section 2.
+func applyJSONMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = applyJSONMergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+//applyJSONPatch implements the operations from RFC 6902, section 4.
+func applyJSONPatch(document interface{}, operations []interface{}) (interface{}, error) {
+	for idx, operation := range operations {
+		op, ok := operation.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operation #%d is not an object", idx+1)
+		}
+		var err error
+		document, err = applyJSONPatchOperation(document, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation #%d (%s %v): %s", idx+1, op["op"], op["path"], err.Error())
+		}
+	}
+	return document, nil
+}
+
+func applyJSONPatchOperation(document interface{}, op map[string]interface{}) (interface{}, error) {
+	path, err := jsonPointerMember(op, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch op["op"] {
+	case "add":
+		value, ok := op["value"]
+		if !ok {
+			return nil, errors.New(`missing "value"`)
+		}
+		return jsonPointerAdd(document, path, value)
+	case "remove":
+		document, _, err = jsonPointerRemove(document, path)
+		return document, err
+	case "replace":
+		value, ok := op["value"]
+		if !ok {
+			return nil, errors.New(`missing "value"`)
+		}
+		document, _, err = jsonPointerRemove(document, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(document, path, value)
+	case "move", "copy":
+		from, err := jsonPointerMember(op, "from")
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if op["op"] == "move" {
+			//a value cannot be moved into one of its children (RFC 6902,
+			//section 4.4)
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("cannot move %v into itself", op["from"])
+			}
+			document, value, err = jsonPointerRemove(document, from)
+		} else {
+			//the copy must not share objects or arrays with the original, lest
+			//later operations on the copy change the original, too
+			value, err = jsonPointerGet(document, from)
+			value = copyJSON(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(document, path, value)
+	case "test":
+		actual, err := jsonPointerGet(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(actual, op["value"]) {
+			return nil, errors.New("test failed")
+		}
+		return document, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %v", op["op"])
+	}
+}
+
+//copyJSON returns a deep copy of a decoded JSON value.
+func copyJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, member := range value {
+			result[key] = copyJSON(member)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for idx, element := range value {
+			result[idx] = copyJSON(element)
+		}
+		return result
+	default:
+		//strings, numbers, booleans and null are immutable
+		return value
+	}
+}
+
+//jsonPointerMember reads a JSON pointer (RFC 6901) from the given member of the
+//given operation, and splits it into its reference tokens.
+func jsonPointerMember(op map[string]interface{}, member string) ([]string, error) {
+	pointer, ok := op[member].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing %q", member)
+	}
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		tokens[idx] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+//jsonArrayIndex parses an array index from a JSON pointer. The index may be
+//equal to the array length only if allowEnd is given.
+func jsonArrayIndex(token string, array []interface{}, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return len(array), nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if idx > len(array) || (idx == len(array) && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+	return idx, nil
+}
+
+func jsonPointerGet(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := document.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			document = value
+		case []interface{}:
+			idx, err := jsonArrayIndex(token, container, false)
+			if err != nil {
+				return nil, err
+			}
+			document = container[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q", token)
+		}
+	}
+	return document, nil
+}
+
+func jsonPointerAdd(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := jsonPointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = value
+		return document, nil
+	case []interface{}:
+		idx, err := jsonArrayIndex(token, container, true)
+		if err != nil {
+			return nil, err
+		}
+		container = append(container, nil)
+		copy(container[idx+1:], container[idx:])
+		container[idx] = value
+		return jsonPointerReplaceArray(document, path[:len(path)-1], container)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", token)
+	}
+}
+
+func jsonPointerRemove(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+	parent, err := jsonPointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		value, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", token)
+		}
+		delete(container, token)
+		return document, value, nil
+	case []interface{}:
+		idx, err := jsonArrayIndex(token, container, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := container[idx]
+		container = append(container[:idx:idx], container[idx+1:]...)
+		document, err = jsonPointerReplaceArray(document, path[:len(path)-1], container)
+		return document, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from %q", token)
+	}
+}
+
+//jsonPointerReplaceArray stores a modified array at the given path (since
+//arrays are values in Go, modifying their length does not modify the document).
+func jsonPointerReplaceArray(document interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+	parent, err := jsonPointerGet(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = array
+	case []interface{}:
+		idx, _ := jsonArrayIndex(token, container, false)
+		container[idx] = array
+	}
+	return document, nil
+}
+
+//jsonEqual compares two JSON values. Numbers are compared by value, also
+//inside objects and arrays.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		numB, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		floatA, errA := a.Float64()
+		floatB, errB := numB.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	case map[string]interface{}:
+		objectB, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(objectB) {
+			return false
+		}
+		for key, member := range a {
+			memberB, exists := objectB[key]
+			if !exists || !jsonEqual(member, memberB) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		arrayB, ok := b.([]interface{})
+		if !ok || len(a) != len(arrayB) {
+			return false
+		}
+		for idx, element := range a {
+			if !jsonEqual(element, arrayB[idx]) {
+				return false
+			}
+		}
+		return true
+	default:
+		//strings, booleans and null
+		return a == b
+	}
+}
@@ -0,0 +1,210 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+//lineDirective is a single directive from a `.hololines` repo file.
+type lineDirective struct {
+	verb  string //"ensure", "absent", "replace" or "insert after"
+	line  string //for "ensure", "replace" and "insert after", and for "absent" without regex
+	regex *regexp.Regexp
+}
+
+func applyLines(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	directives, err := parseLineDirectives(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", repoFile.Path(), err.Error())
+	}
+
+	text := string(buffer.Contents)
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, directive := range directives {
+		lines = directive.applyTo(lines)
+	}
+
+	//keep the trailing newline (or its absence) intact
+	resultText := strings.Join(lines, "\n")
+	if len(lines) > 0 && (text == "" || strings.HasSuffix(text, "\n")) {
+		resultText += "\n"
+	}
+	return NewFileBufferFromContents([]byte(resultText), buffer.BasePath), nil
+}
+
+//parseLineDirectives parses the contents of a `.hololines` repo file.
+//
+//    ensure LINE
+//    absent LINE
+//    absent /REGEX/
+//    replace /REGEX/ with LINE
+//    insert after /REGEX/ LINE
+//
+//Empty lines and lines starting with "#" are ignored.
+func parseLineDirectives(text string) ([]lineDirective, error) {
+	var directives []lineDirective
+	for idx, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, err := parseLineDirective(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", idx+1, err.Error())
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+func parseLineDirective(line string) (lineDirective, error) {
+	var d lineDirective
+	var err error
+
+	switch {
+	case strings.HasPrefix(line, "ensure "):
+		d.verb = "ensure"
+		d.line = strings.TrimPrefix(line, "ensure ")
+	case strings.HasPrefix(line, "absent /"):
+		d.verb = "absent"
+		var rest string
+		d.regex, rest, err = parseLineRegex(strings.TrimPrefix(line, "absent "))
+		if err == nil && rest != "" {
+			err = fmt.Errorf("unexpected %q after regex", rest)
+		}
+	case strings.HasPrefix(line, "absent "):
+		d.verb = "absent"
+		d.line = strings.TrimPrefix(line, "absent ")
+	case strings.HasPrefix(line, "replace "):
+		d.verb = "replace"
+		var rest string
+		d.regex, rest, err = parseLineRegex(strings.TrimPrefix(line, "replace "))
+		if err == nil {
+			if !strings.HasPrefix(rest, " with ") {
+				err = errors.New(`expected "with" after regex`)
+			}
+			d.line = strings.TrimPrefix(rest, " with ")
+		}
+	case strings.HasPrefix(line, "insert after "):
+		d.verb = "insert after"
+		var rest string
+		d.regex, rest, err = parseLineRegex(strings.TrimPrefix(line, "insert after "))
+		if err == nil {
+			if !strings.HasPrefix(rest, " ") {
+				err = errors.New("expected line after regex")
+			}
+			d.line = strings.TrimPrefix(rest, " ")
+		}
+	default:
+		err = fmt.Errorf("unknown directive: %s", line)
+	}
+
+	return d, err
+}
+
+//parseLineRegex parses a regex delimited by slashes at the start of the given
+//text, and returns the rest of the text. Slashes within the regex must be
+//escaped as "\/".
+func parseLineRegex(text string) (*regexp.Regexp, string, error) {
+	if !strings.HasPrefix(text, "/") {
+		return nil, "", errors.New("expected regex delimited by slashes")
+	}
+	for idx := 1; idx < len(text); idx++ {
+		switch text[idx] {
+		case '\\':
+			idx++ //skip escaped character
+		case '/':
+			pattern := strings.Replace(text[1:idx], `\/`, "/", -1)
+			rx, err := regexp.Compile(pattern)
+			return rx, text[idx+1:], err
+		}
+	}
+	return nil, "", errors.New("unterminated regex")
+}
+
+//applyTo applies this directive to the given lines. Lines are only added if
+//they are not present yet, so that stacked repo files (or a target base that
+//already contains the line) do not produce duplicates.
+func (d lineDirective) applyTo(lines []string) []string {
+	switch d.verb {
+	case "ensure":
+		if !containsLine(lines, d.line) {
+			lines = append(lines, d.line)
+		}
+		return lines
+	case "absent":
+		result := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if d.regex != nil && !d.regex.MatchString(line) || d.regex == nil && line != d.line {
+				result = append(result, line)
+			}
+		}
+		return result
+	case "replace":
+		result := make([]string, len(lines))
+		for idx, line := range lines {
+			result[idx] = d.regex.ReplaceAllString(line, d.line)
+		}
+		return result
+	case "insert after":
+		if containsLine(lines, d.line) {
+			return lines
+		}
+		//insert after the last matching line, or at the end if nothing matches
+		insertAt := len(lines)
+		for idx, line := range lines {
+			if d.regex.MatchString(line) {
+				insertAt = idx + 1
+			}
+		}
+		result := make([]string, 0, len(lines)+1)
+		result = append(result, lines[:insertAt]...)
+		result = append(result, d.line)
+		return append(result, lines[insertAt:]...)
+	}
+	return lines
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
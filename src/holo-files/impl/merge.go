@@ -0,0 +1,211 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"fmt"
+	"strings"
+
+	"../common"
+)
+
+//lineChange describes a change in a diff: The lines base[start:end] are
+//replaced by the given lines.
+type lineChange struct {
+	start int
+	end   int
+	lines []string
+}
+
+//changesOf converts an edit script into a list of changes.
+func changesOf(script []diffLine) []lineChange {
+	var changes []lineChange
+	var current *lineChange
+	baseIdx := 0
+	for _, line := range script {
+		if line.kind == ' ' {
+			if current != nil {
+				changes = append(changes, *current)
+				current = nil
+			}
+			baseIdx++
+			continue
+		}
+		if current == nil {
+			current = &lineChange{start: baseIdx, end: baseIdx}
+		}
+		if line.kind == '-' {
+			current.end++
+			baseIdx++
+		} else {
+			current.lines = append(current.lines, line.text)
+		}
+	}
+	if current != nil {
+		changes = append(changes, *current)
+	}
+	return changes
+}
+
+//applyChanges returns the lines base[start:end] with the given changes
+//applied (all of which must be within this range).
+func applyChanges(base []string, start, end int, changes []lineChange) []string {
+	var result []string
+	for _, change := range changes {
+		result = append(result, base[start:change.start]...)
+		result = append(result, change.lines...)
+		start = change.end
+	}
+	return append(result, base[start:end]...)
+}
+
+//mergeLines performs a three-way merge (like diff3(1)) of the changes from
+//base to ours, and the changes from base to theirs. Changes that overlap or
+//touch each other are conflicts, unless they are identical. Conflicts are
+//marked with conflict markers in the result. The returned messages describe
+//the changes from ours that were merged, and the conflicts.
+func mergeLines(base, ours, theirs []string) (result []string, messages []string, conflicts int) {
+	oursChanges := changesOf(diffLines(base, ours))
+	theirsChanges := changesOf(diffLines(base, theirs))
+
+	pos := 0
+	i, j := 0, 0
+	for i < len(oursChanges) || j < len(theirsChanges) {
+		//start a chunk with the next change from either side, and extend it by
+		//all changes that overlap or touch it
+		var start, end int
+		if j == len(theirsChanges) || (i < len(oursChanges) && oursChanges[i].start <= theirsChanges[j].start) {
+			start, end = oursChanges[i].start, oursChanges[i].end
+		} else {
+			start, end = theirsChanges[j].start, theirsChanges[j].end
+		}
+		firstOurs, firstTheirs := i, j
+		for {
+			if i < len(oursChanges) && oursChanges[i].start <= end {
+				if oursChanges[i].end > end {
+					end = oursChanges[i].end
+				}
+				i++
+			} else if j < len(theirsChanges) && theirsChanges[j].start <= end {
+				if theirsChanges[j].end > end {
+					end = theirsChanges[j].end
+				}
+				j++
+			} else {
+				break
+			}
+		}
+
+		//copy the unchanged lines before this chunk
+		result = append(result, base[pos:start]...)
+		pos = end
+
+		oursLines := applyChanges(base, start, end, oursChanges[firstOurs:i])
+		theirsLines := applyChanges(base, start, end, theirsChanges[firstTheirs:j])
+		switch {
+		case i == firstOurs:
+			//only changed in the new version
+			result = append(result, theirsLines...)
+		case j == firstTheirs:
+			//only changed by the user
+			messages = append(messages, "kept change by user "+describeLines(len(result), len(oursLines)))
+			result = append(result, oursLines...)
+		case strings.Join(oursLines, "") == strings.Join(theirsLines, ""):
+			//the user made the same change as the new version
+			result = append(result, theirsLines...)
+		default:
+			conflictStart := len(result)
+			result = appendConflictSection(result, "<<<<<<< current version", oursLines)
+			result = appendConflictSection(result, "||||||| last provisioned version", base[start:end])
+			result = appendConflictSection(result, "=======", theirsLines)
+			result = append(result, ">>>>>>> new version\n")
+			messages = append(messages, "conflicting changes "+describeLines(conflictStart, len(result)-conflictStart))
+			conflicts++
+		}
+	}
+
+	result = append(result, base[pos:]...)
+	return result, messages, conflicts
+}
+
+//appendConflictSection appends a conflict marker line and the given lines to
+//result. (The last line of a section always ends with a newline, so that the
+//next conflict marker starts on a new line.)
+func appendConflictSection(result []string, marker string, lines []string) []string {
+	result = append(result, marker+"\n")
+	result = append(result, lines...)
+	if last := len(result) - 1; !strings.HasSuffix(result[last], "\n") {
+		result[last] += "\n"
+	}
+	return result
+}
+
+//describeLines describes the given lines of the merge result for a message,
+//given the number of lines before them.
+func describeLines(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("at line %d (lines removed)", before+1)
+	case 1:
+		return fmt.Sprintf("in line %d", before+1)
+	default:
+		return fmt.Sprintf("in lines %d-%d", before+1, before+count)
+	}
+}
+
+//mergeBuffers merges the changes that the user made to the last provisioned
+//version of a target into the new version of the target, and prints the
+//merged changes. Symlinks and binary files cannot be merged. When there are
+//conflicts, the result with conflict markers is written next to the target
+//(with a ".holomerge" suffix) for the user to resolve, and an error is
+//returned.
+func mergeBuffers(lastProvisioned, current, next *FileBuffer) (*FileBuffer, error) {
+	for _, buffer := range []*FileBuffer{lastProvisioned, current, next} {
+		if buffer.SymlinkTarget != "" {
+			return nil, fmt.Errorf("cannot merge changes by user into %s: symlinks cannot be merged", next.BasePath)
+		}
+		if isBinary(buffer.Contents) {
+			return nil, fmt.Errorf("cannot merge changes by user into %s: binary files cannot be merged", next.BasePath)
+		}
+	}
+
+	result, messages, conflicts := mergeLines(
+		splitLines(string(lastProvisioned.Contents)),
+		splitLines(string(current.Contents)),
+		splitLines(string(next.Contents)),
+	)
+	for _, message := range messages {
+		fmt.Printf(">> %s\n", message)
+	}
+	contents := []byte(strings.Join(result, ""))
+	if conflicts > 0 {
+		//the target may contain sensitive data, so don't make the merge result
+		//readable for everyone
+		mergePath := next.BasePath + ".holomerge"
+		err := common.WriteFileSynced(mergePath, contents, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s has %d merge conflict(s), see %s (resolve them, copy the result to the target and use `holo adopt` to accept it, or use `holo apply --force` to discard the changes by user)",
+			next.BasePath, conflicts, mergePath)
+	}
+	return NewFileBufferFromContents(contents, next.BasePath), nil
+}
@@ -0,0 +1,373 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"../../internal/toml"
+	"../../lib/holo"
+	"../common"
+)
+
+//metaSuffix is the suffix of sidecar files in the repository that contain
+//metadata for a target (e.g. "/usr/share/holo/files/20-foo/etc/foo.conf.holometa").
+const metaSuffix = ".holometa"
+
+//TargetMeta contains the metadata for a target file, as merged from all
+//`.holometa` sidecar files for this target.
+type TargetMeta struct {
+	//if set, the target is created (with an empty target base) if it does not exist
+	Create bool `toml:"create"`
+	//the mode of the target, as an octal number in a string (default: copied
+	//from the target base, or "0644" for created targets)
+	Mode string `toml:"mode"`
+	//the owner and group of the target, by name or by ID (default: copied from
+	//the target base, or the user running holo for created targets)
+	Owner string `toml:"owner"`
+	Group string `toml:"group"`
+	//if set, the modification time of the target is kept when its contents do
+	//not change
+	PreserveMtime bool `toml:"preserve_mtime"`
+	//the number of generations of the provisioned file that are kept for
+	//`holo rollback` (default: defaultGenerations)
+	Generations *int `toml:"generations"`
+	//if set, holoscripts for this target are killed when they run longer than
+	//this (e.g. "30s")
+	ScriptTimeout string `toml:"script_timeout"`
+	//if set, this command is run on the result for this target before it is
+	//written, and must succeed (e.g. "visudo -cf %s", see validatorCommand)
+	Validate string `toml:"validate"`
+}
+
+//AddMetaFile registers a `.holometa` sidecar file in this TargetFile instance.
+func (target *TargetFile) AddMetaFile(path string) {
+	target.metaFiles = append(target.metaFiles, path)
+}
+
+//Meta reads the `.holometa` sidecar files for this target. When multiple
+//sidecar files exist, later files override the fields set by earlier files.
+//The merged metadata is validated, so its mode, owner and group can be used
+//without further error checking.
+func (target *TargetFile) Meta() (TargetMeta, error) {
+	var meta TargetMeta
+	sort.Strings(target.metaFiles)
+	for _, path := range target.metaFiles {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return meta, err
+		}
+		md, err := toml.Decode(string(blob), &meta)
+		if err != nil {
+			return meta, fmt.Errorf("cannot parse %s: %s", path, err.Error())
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return meta, fmt.Errorf("cannot parse %s: unknown key %s", path, undecoded[0].String())
+		}
+	}
+
+	_, err := meta.wantedAttributes(nil)
+	if err == nil && meta.KeptGenerations() < 0 {
+		err = fmt.Errorf("invalid number of generations %d", meta.KeptGenerations())
+	}
+	if err == nil {
+		_, err = meta.ScriptTimeoutDuration()
+	}
+	if err == nil && meta.Validate != "" {
+		_, err = meta.validatorCommand("")
+	}
+	if err != nil {
+		return meta, fmt.Errorf("invalid metadata for %s: %s", target.PathIn(holo.TargetDirectory()), err.Error())
+	}
+	return meta, nil
+}
+
+//KeptGenerations returns the number of generations of the provisioned file
+//that are kept for `holo rollback`.
+func (meta TargetMeta) KeptGenerations() int {
+	if meta.Generations == nil {
+		return defaultGenerations
+	}
+	return *meta.Generations
+}
+
+//ScriptTimeoutDuration returns the timeout for holoscripts for this target, or
+//0 if no timeout was given.
+func (meta TargetMeta) ScriptTimeoutDuration() (time.Duration, error) {
+	if meta.ScriptTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(meta.ScriptTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid script timeout %q", meta.ScriptTimeout)
+	}
+	return timeout, nil
+}
+
+//FileMode returns the mode of the target (or 0644 if no mode was given).
+func (meta TargetMeta) FileMode() (os.FileMode, error) {
+	if meta.Mode == "" {
+		return 0644, nil
+	}
+	mode, err := strconv.ParseUint(meta.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("invalid mode %q", meta.Mode)
+	}
+	//translate the special bits into their os.FileMode representation
+	result := os.FileMode(mode) & os.ModePerm
+	if mode&04000 != 0 {
+		result |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		result |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		result |= os.ModeSticky
+	}
+	return result, nil
+}
+
+//UID returns the owner of the target, or -1 if no owner was given.
+func (meta TargetMeta) UID() (int, error) {
+	return lookupID(meta.Owner, "owner", func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+}
+
+//GID returns the group of the target, or -1 if no group was given.
+func (meta TargetMeta) GID() (int, error) {
+	return lookupID(meta.Group, "group", func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+}
+
+func lookupID(value, what string, lookup func(string) (string, error)) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	//numeric IDs are used as they are
+	if id, err := strconv.Atoi(value); err == nil && id >= 0 {
+		return id, nil
+	}
+	idStr, err := lookup(value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid %s %q: %s", what, value, err.Error())
+	}
+	return strconv.Atoi(idStr)
+}
+
+//fileAttributes contains the mode and ownership of a file, as far as they are
+//managed by the metadata. Unmanaged attributes are left at their zero value.
+type fileAttributes struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+//wantedAttributes returns the attributes requested by the metadata for the
+//given file. Symlinks do not have a mode of their own, so the mode is not
+//managed for them. (If info is nil, only the metadata is validated.)
+func (meta TargetMeta) wantedAttributes(info os.FileInfo) (fileAttributes, error) {
+	var attrs fileAttributes
+	var err error
+	if meta.Mode != "" {
+		attrs.Mode, err = meta.FileMode()
+		if err != nil {
+			return attrs, err
+		}
+		if info != nil && common.IsFileInfoASymbolicLink(info) {
+			attrs.Mode = 0
+		}
+	}
+	if meta.Owner != "" {
+		attrs.UID, err = meta.UID()
+		if err != nil {
+			return attrs, err
+		}
+	}
+	if meta.Group != "" {
+		attrs.GID, err = meta.GID()
+		if err != nil {
+			return attrs, err
+		}
+	}
+	return attrs, nil
+}
+
+//actualAttributes returns the attributes of the given file that are managed
+//by the metadata.
+func (meta TargetMeta) actualAttributes(info os.FileInfo) fileAttributes {
+	var attrs fileAttributes
+	if meta.Mode != "" && !common.IsFileInfoASymbolicLink(info) {
+		attrs.Mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if meta.Owner != "" {
+		attrs.UID = int(stat.Uid)
+	}
+	if meta.Group != "" {
+		attrs.GID = int(stat.Gid)
+	}
+	return attrs
+}
+
+//applyAttributes sets the mode and ownership requested by the metadata on the
+//file at the given path. Attributes that are not set in the metadata are left
+//alone (i.e. as they were copied from the target base).
+func (meta TargetMeta) applyAttributes(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	attrs, err := meta.wantedAttributes(info)
+	if err != nil {
+		return err
+	}
+	//chown before chmod, since chown clears the setuid and setgid bits
+	uid, gid := -1, -1
+	if meta.Owner != "" {
+		uid = attrs.UID
+	}
+	if meta.Group != "" {
+		gid = attrs.GID
+	}
+	if uid >= 0 || gid >= 0 {
+		err = common.Lchown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	if meta.Mode != "" && !common.IsFileInfoASymbolicLink(info) {
+		return os.Chmod(path, attrs.Mode)
+	}
+	return nil
+}
+
+//hasAttributes returns whether the file at the given path has the mode and
+//ownership requested by the metadata.
+func (meta TargetMeta) hasAttributes(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	wanted, err := meta.wantedAttributes(info)
+	if err != nil {
+		return false, err
+	}
+	return meta.actualAttributes(info) == wanted, nil
+}
+
+//attributesDiffer returns whether the files at the given paths differ in the
+//mode or ownership managed by the metadata.
+func (meta TargetMeta) attributesDiffer(path1, path2 string) (bool, error) {
+	info1, err := os.Lstat(path1)
+	if err != nil {
+		return false, err
+	}
+	info2, err := os.Lstat(path2)
+	if err != nil {
+		return false, err
+	}
+	return meta.actualAttributes(info1) != meta.actualAttributes(info2), nil
+}
+
+//createTargetBase creates an empty target base for a target that does not
+//exist yet, and remembers that the target was created by Holo.
+func (target *TargetFile) createTargetBase(meta TargetMeta) error {
+	mode, err := meta.FileMode()
+	if err != nil {
+		return err
+	}
+	uid, err := meta.UID()
+	if err != nil {
+		return err
+	}
+	gid, err := meta.GID()
+	if err != nil {
+		return err
+	}
+
+	targetBasePath := target.PathIn(common.TargetBaseDirectory())
+	err = os.MkdirAll(filepath.Dir(targetBasePath), 0755)
+	if err != nil {
+		return err
+	}
+	err = common.WriteFileSynced(targetBasePath, nil, mode)
+	if err != nil {
+		return err
+	}
+	//chown before chmod, since chown clears the setuid and setgid bits
+	if uid >= 0 || gid >= 0 {
+		err = common.Lchown(targetBasePath, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	//WriteFileSynced's mode is subject to the umask
+	err = os.Chmod(targetBasePath, mode)
+	if err != nil {
+		return err
+	}
+	err = common.SyncDirectory(filepath.Dir(targetBasePath))
+	if err != nil {
+		return err
+	}
+
+	createdPath := target.PathIn(common.CreatedDirectory())
+	err = os.MkdirAll(filepath.Dir(createdPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = common.WriteFileSynced(createdPath, nil, 0644)
+	if err != nil {
+		return err
+	}
+	return common.SyncDirectory(filepath.Dir(createdPath))
+}
+
+//wasCreated returns whether this target was created by Holo (rather than
+//being installed by a package).
+func (target *TargetFile) wasCreated() bool {
+	_, err := os.Lstat(target.PathIn(common.CreatedDirectory()))
+	return err == nil
+}
+
+//isMetaFile returns whether the given repo path is a `.holometa` sidecar file.
+func isMetaFile(repoPath string) bool {
+	return strings.HasSuffix(repoPath, metaSuffix)
+}
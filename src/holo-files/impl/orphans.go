@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"os"
 
+	"../../lib/holo"
 	"../common"
 	"../platform"
 )
@@ -32,7 +33,15 @@ import (
 //and assesses the situation. This logic is grouped in one function because
 //it's used by both `holo scan` and `holo apply`.
 func (target *TargetFile) scanOrphanedTargetBase() (theTargetPath, strategy, assessment string) {
-	targetPath := target.PathIn(common.TargetDirectory())
+	targetPath := target.PathIn(holo.TargetDirectory())
+	//targets created by Holo are deleted instead of restoring their empty target base
+	if target.wasCreated() {
+		return targetPath, "delete", "all repository files were deleted"
+	}
+	//targets deleted by Holo are restored
+	if target.wasDeleted() {
+		return targetPath, "restore", "all repository files were deleted"
+	}
 	if common.IsManageableFile(targetPath) {
 		return targetPath, "restore", "all repository files were deleted"
 	}
@@ -44,8 +53,17 @@ func (target *TargetFile) handleOrphanedTargetBase() error {
 	targetPath, strategy, _ := target.scanOrphanedTargetBase()
 	targetBasePath := target.PathIn(common.TargetBaseDirectory())
 
+	tx := target.newTransaction()
+	defer tx.abort()
 	switch strategy {
 	case "delete":
+		//targets created by Holo are still there
+		if target.wasCreated() {
+			err := tx.removeFile(targetPath)
+			if err != nil {
+				return err
+			}
+		}
 		//if the package management left behind additional cleanup targets
 		//(most likely a backup of our custom configuration), we can delete
 		//these too
@@ -58,24 +76,48 @@ func (target *TargetFile) handleOrphanedTargetBase() error {
 			}
 		}
 	case "restore":
-		//target is still there - restore the target base
-		err := common.CopyFile(targetBasePath, targetPath)
+		//target is still there (or was deleted by Holo) - restore the target base
+		baseBuffer, err := NewFileBuffer(targetBasePath, targetPath)
+		if err != nil {
+			return err
+		}
+		err = tx.writeFile(targetPath, baseBuffer, func(tempPath string) error {
+			return common.ApplyFilePermissions(targetBasePath, tempPath)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	//target is not managed by Holo anymore, so delete the provisioned target and the target base
-	lastProvisionedPath := target.PathIn(common.ProvisionedDirectory())
-	err := os.Remove(lastProvisionedPath)
-	if err != nil && !os.IsNotExist(err) {
+	//target is not managed by Holo anymore, so delete the provisioned target,
+	//the target base and all markers
+	for _, stateDir := range []string{
+		common.ProvisionedDirectory(),
+		common.CreatedDirectory(),
+		common.DeletedDirectory(),
+		common.AdoptedDirectory(),
+		common.TargetBaseDirectory(),
+	} {
+		err := tx.removeFile(target.PathIn(stateDir))
+		if err != nil {
+			return err
+		}
+	}
+	err := tx.commit()
+	if err != nil {
 		return err
 	}
-	err = os.Remove(targetBasePath)
+	err = os.RemoveAll(target.generationsPath())
 	if err != nil {
 		return err
 	}
 
-	//TODO: cleanup empty directories below TargetBaseDirectory() and ProvisionedDirectory()
+	//the state directories might have become empty
+	for _, stateDir := range common.StateDirectories() {
+		err = common.PruneEmptyDirectories(target.PathIn(stateDir), stateDir)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
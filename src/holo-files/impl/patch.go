@@ -0,0 +1,261 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//maxFuzz is the maximum number of context lines at the start and end of a
+//hunk that may be ignored when the hunk does not match exactly (like the
+//default of patch(1)).
+const maxFuzz = 2
+
+//patchHunk is a single hunk of a unified diff. All lines include their line
+//terminator (unless the file does not end with a newline).
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldLines []string
+	newLines []string
+	//number of context lines at the start and end of the hunk
+	leadingContext  int
+	trailingContext int
+}
+
+var hunkHeaderRx = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func applyPatch(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	hunks, err := parsePatch(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", repoFile.Path(), err.Error())
+	}
+
+	lines := splitLines(string(buffer.Contents))
+	delta := 0
+	minPos := 0
+	for idx, hunk := range hunks {
+		var oldLines, newLines []string
+		var pos, offset int
+		found := false
+		fuzz := 0
+		for ; fuzz <= maxFuzz; fuzz++ {
+			oldLines, newLines, pos, offset, found = hunk.locate(lines, delta, minPos, fuzz)
+			if found {
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot apply %s to %s: hunk #%d (%s) does not match",
+				repoFile.Path(), buffer.BasePath, idx+1, hunk.header,
+			)
+		}
+		if fuzz > 0 {
+			fmt.Fprintf(os.Stderr, ">> %s: hunk #%d (%s) applied with fuzz %d\n",
+				repoFile.Path(), idx+1, hunk.header, fuzz,
+			)
+		}
+
+		//replace the old lines by the new lines
+		result := make([]string, 0, len(lines)-len(oldLines)+len(newLines))
+		result = append(result, lines[:pos]...)
+		result = append(result, newLines...)
+		result = append(result, lines[pos+len(oldLines):]...)
+		lines = result
+
+		//the following hunks are expected to be shifted by the same offset
+		//as this one, and by the number of lines that this hunk has added
+		minPos = pos + len(newLines)
+		delta += offset + len(newLines) - len(oldLines)
+	}
+
+	return NewFileBufferFromContents([]byte(strings.Join(lines, "")), buffer.BasePath), nil
+}
+
+//expectedPosition returns the index into the buffer lines where the hunk's
+//old lines are expected to start, taking into account the given delta (the
+//number of lines that previous hunks have added or removed).
+func (hunk patchHunk) expectedPosition(delta int) int {
+	//for hunks that only add lines, the start line is the line *after* which
+	//the new lines are inserted
+	if len(hunk.oldLines) == 0 {
+		return hunk.oldStart + delta
+	}
+	return hunk.oldStart - 1 + delta
+}
+
+//locate finds the position of the hunk in the given lines. With nonzero fuzz,
+//up to that many context lines at the start and end of the hunk are ignored.
+//Returns the old and new lines without the ignored context lines, the
+//position where the old lines were found, and the offset of that position
+//from the expected position.
+func (hunk patchHunk) locate(lines []string, delta, minPos, fuzz int) (oldLines, newLines []string, pos, offset int, found bool) {
+	front, back := fuzz, fuzz
+	if front > hunk.leadingContext {
+		front = hunk.leadingContext
+	}
+	if back > hunk.trailingContext {
+		back = hunk.trailingContext
+	}
+	if fuzz > 0 && front == 0 && back == 0 {
+		//same as without fuzz, no need to search again
+		return nil, nil, 0, 0, false
+	}
+	oldLines = hunk.oldLines[front : len(hunk.oldLines)-back]
+	newLines = hunk.newLines[front : len(hunk.newLines)-back]
+
+	//search outwards from the expected position (patch(1) calls the distance
+	//between expected and actual position the "offset")
+	expected := hunk.expectedPosition(delta) + front
+	maxPos := len(lines) - len(oldLines)
+	for distance := 0; expected-distance >= minPos || expected+distance <= maxPos; distance++ {
+		for _, pos := range []int{expected + distance, expected - distance} {
+			if pos >= minPos && pos <= maxPos && linesMatch(lines[pos:pos+len(oldLines)], oldLines) {
+				return oldLines, newLines, pos, pos - expected, true
+			}
+		}
+	}
+	return nil, nil, 0, 0, false
+}
+
+func linesMatch(lines, expected []string) bool {
+	for idx, line := range expected {
+		if lines[idx] != line {
+			return false
+		}
+	}
+	return true
+}
+
+//splitLines splits the given text into lines, retaining the line terminators.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	//SplitAfter gives an empty string at the end if text ends with "\n"
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+//parsePatch parses a unified diff. File headers (like "--- a/foo" or
+//"diff --git ...") are skipped.
+func parsePatch(text string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	lines := splitLines(text)
+
+	for idx := 0; idx < len(lines); idx++ {
+		line := strings.TrimSuffix(lines[idx], "\n")
+		match := hunkHeaderRx.FindStringSubmatch(line)
+		if match == nil {
+			//skip over file headers before the first hunk
+			switch {
+			case len(hunks) == 0:
+				continue
+			case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "--- "):
+				return nil, errors.New("patch contains changes for multiple files")
+			default:
+				return nil, fmt.Errorf("unexpected line %d: %s", idx+1, line)
+			}
+		}
+
+		//parse hunk header
+		hunk := patchHunk{header: strings.TrimSpace(match[0])}
+		hunk.oldStart, _ = strconv.Atoi(match[1])
+		oldCount, newCount := 1, 1
+		if match[2] != "" {
+			oldCount, _ = strconv.Atoi(match[2])
+		}
+		if match[4] != "" {
+			newCount, _ = strconv.Atoi(match[4])
+		}
+
+		//read hunk lines until the line counts from the header are satisfied
+		seenChange := false
+		for len(hunk.oldLines) < oldCount || len(hunk.newLines) < newCount {
+			idx++
+			if idx >= len(lines) {
+				return nil, fmt.Errorf("hunk %s ends prematurely", hunk.header)
+			}
+			hunkLine := lines[idx]
+			//some editors strip the space from empty context lines
+			if hunkLine == "\n" {
+				hunkLine = " \n"
+			}
+			content := hunkLine[1:]
+			switch hunkLine[0] {
+			case ' ':
+				hunk.oldLines = append(hunk.oldLines, content)
+				hunk.newLines = append(hunk.newLines, content)
+				if seenChange {
+					hunk.trailingContext++
+				} else {
+					hunk.leadingContext++
+				}
+			case '-':
+				hunk.oldLines = append(hunk.oldLines, content)
+				seenChange = true
+				hunk.trailingContext = 0
+			case '+':
+				hunk.newLines = append(hunk.newLines, content)
+				seenChange = true
+				hunk.trailingContext = 0
+			default:
+				return nil, fmt.Errorf("unexpected line %d: %s", idx+1, strings.TrimSuffix(hunkLine, "\n"))
+			}
+
+			//a following "\ No newline at end of file" applies to this line
+			if idx+1 < len(lines) && strings.HasPrefix(lines[idx+1], "\\") {
+				idx++
+				stripLastNewline(hunk.oldLines, hunkLine[0] != '+')
+				stripLastNewline(hunk.newLines, hunkLine[0] != '-')
+			}
+		}
+
+		hunks = append(hunks, hunk)
+	}
+
+	if len(hunks) == 0 {
+		return nil, errors.New("patch does not contain any hunks")
+	}
+	return hunks, nil
+}
+
+func stripLastNewline(lines []string, doIt bool) {
+	if doIt && len(lines) > 0 {
+		lines[len(lines)-1] = strings.TrimSuffix(lines[len(lines)-1], "\n")
+	}
+}
@@ -0,0 +1,108 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"fmt"
+	"os"
+
+	"../../lib/holo"
+)
+
+//FilesPlugin implements the holo.CachingPlugin interface for target files.
+type FilesPlugin struct {
+	//filled by Scan() for use by StoreCache()
+	repoDirs []RepoDirectory
+	//set by recover() when interrupted transactions have been completed
+	recovered bool
+}
+
+//recover completes interrupted transactions before the first entity is changed
+//(see transaction). Errors are reported on stderr. This is deliberately not
+//done by Scan() and Diff(), which must not change anything (and usually run
+//without the privileges to do so).
+func (p *FilesPlugin) recover() bool {
+	if !p.recovered {
+		err := recoverTransactions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+			return false
+		}
+		p.recovered = true
+	}
+	return true
+}
+
+//Scan implements the holo.Plugin interface.
+func (p *FilesPlugin) Scan() []holo.Entity {
+	targets, repoDirs := ScanRepo()
+	p.repoDirs = repoDirs
+	entities := make([]holo.Entity, 0, len(targets))
+	for _, target := range targets {
+		entities = append(entities, target)
+	}
+	return entities
+}
+
+//Apply implements the holo.Plugin interface.
+func (p *FilesPlugin) Apply(entity holo.Entity, withForce bool) bool {
+	if !p.recover() {
+		return false
+	}
+	skipReport := entity.(*TargetFile).Apply(withForce, false)
+	return !skipReport
+}
+
+//ApplyWithMerge implements the holo.MergingPlugin interface.
+func (p *FilesPlugin) ApplyWithMerge(entity holo.Entity) bool {
+	if !p.recover() {
+		return false
+	}
+	skipReport := entity.(*TargetFile).Apply(false, true)
+	return !skipReport
+}
+
+//Adopt implements the holo.AdoptingPlugin interface.
+func (p *FilesPlugin) Adopt(entity holo.Entity, exportDir string, asPatch bool) {
+	if !p.recover() {
+		return
+	}
+	err := entity.(*TargetFile).Adopt(exportDir, asPatch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+	}
+}
+
+//Rollback implements the holo.RollbackPlugin interface.
+func (p *FilesPlugin) Rollback(entity holo.Entity, generation int) {
+	if !p.recover() {
+		return
+	}
+	err := entity.(*TargetFile).Rollback(generation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+	}
+}
+
+//Diff implements the holo.Plugin interface.
+func (p *FilesPlugin) Diff(entity holo.Entity) ([]byte, error) {
+	return entity.(*TargetFile).RenderDiff()
+}
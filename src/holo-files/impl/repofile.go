@@ -25,7 +25,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"../common"
+	"../../lib/holo"
 )
 
 //RepoFile represents a single file in the configuration repository. The string
@@ -45,14 +45,19 @@ func (file RepoFile) Path() string {
 
 //TargetPath returns the path to the corresponding target file.
 func (file RepoFile) TargetPath() string {
-	//the optional ".holoscript" suffix appears only on repo files
-	repoFile := file.Path()
-	if strings.HasSuffix(repoFile, ".holoscript") {
-		repoFile = strings.TrimSuffix(repoFile, ".holoscript")
+	//the optional strategy suffixes (e.g. ".holoscript") appear only on repo
+	//files, as do the suffixes of metadata sidecar files and validators
+	repoFile := strings.TrimSuffix(file.Path(), metaSuffix)
+	repoFile = strings.TrimSuffix(repoFile, validatorSuffix)
+	for suffix := range strategySuffixes {
+		if strings.HasSuffix(repoFile, suffix) {
+			repoFile = strings.TrimSuffix(repoFile, suffix)
+			break
+		}
 	}
 
 	//make path relative
-	relPath, _ := filepath.Rel(common.ResourceDirectory(), repoFile)
+	relPath, _ := filepath.Rel(holo.ResourceDirectory(), repoFile)
 	//remove the disambiguation path element to get to the relPath for the ConfigFile
 	//e.g. repoFile = '/usr/share/holo/files/23-foo/etc/foo.conf'
 	//  -> relPath  = '23-foo/etc/foo.conf'
@@ -60,14 +65,31 @@ func (file RepoFile) TargetPath() string {
 	segments := strings.SplitN(relPath, fmt.Sprintf("%c", filepath.Separator), 2)
 	relPath = segments[1]
 
-	return filepath.Join(common.TargetDirectory(), relPath)
+	return filepath.Join(holo.TargetDirectory(), relPath)
+}
+
+//strategySuffixes maps the file name suffixes of repo files to the
+//application strategies that they select. Repo files without any of these
+//suffixes use the "apply" strategy.
+var strategySuffixes = map[string]string{
+	".holoappend":   "append",
+	".holodelete":   "delete",
+	".holoini":      "ini",
+	".holojson":     "json",
+	".hololines":    "lines",
+	".holopatch":    "patch",
+	".holoprepend":  "prepend",
+	".holoscript":   "passthru",
+	".holotemplate": "template",
 }
 
 //ApplicationStrategy returns the human-readable name for the strategy that
 //will be employed to apply this repo file.
 func (file RepoFile) ApplicationStrategy() string {
-	if strings.HasSuffix(file.Path(), ".holoscript") {
-		return "passthru"
+	for suffix, strategy := range strategySuffixes {
+		if strings.HasSuffix(file.Path(), suffix) {
+			return strategy
+		}
 	}
 	return "apply"
 }
@@ -77,7 +99,8 @@ func (file RepoFile) ApplicationStrategy() string {
 //This is used as a hint by the application algorithm to decide whether
 //application steps can be skipped completely.
 func (file RepoFile) DiscardsPreviousBuffer() bool {
-	return file.ApplicationStrategy() == "apply"
+	strategy := file.ApplicationStrategy()
+	return strategy == "apply" || strategy == "delete"
 }
 
 //RepoFiles holds a slice of RepoFile instances, and implements some methods
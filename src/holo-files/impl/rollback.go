@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"../../lib/holo"
+	"../common"
+)
+
+//Rollback restores an earlier generation of the provisioned copy (see "holo
+//rollback") and records it as the provisioned state. If generationID is 0, the
+//generation before the current provisioned state is restored.
+func (target *TargetFile) Rollback(generationID int) error {
+	targetPath := target.PathIn(holo.TargetDirectory())
+	provisionedPath := target.PathIn(common.ProvisionedDirectory())
+	if target.orphaned {
+		return errors.New("cannot roll back target: all repository files were deleted")
+	}
+	if !common.IsManageableFile(provisionedPath) {
+		return errors.New("cannot roll back target: target has not been provisioned yet")
+	}
+	if !common.IsManageableFile(targetPath) {
+		return errors.New("cannot roll back target: target was deleted")
+	}
+
+	//do not overwrite manual changes (the user shall decide about them first)
+	provisionedBuffer, err := NewFileBuffer(provisionedPath, targetPath)
+	if err != nil {
+		return err
+	}
+	targetBuffer, err := NewFileBuffer(targetPath, targetPath)
+	if err != nil {
+		return err
+	}
+	if !targetBuffer.EqualTo(provisionedBuffer) {
+		return errors.New("cannot roll back target: target was modified by user (use `holo adopt` or `holo apply --force` first)")
+	}
+
+	gen, err := target.chooseGeneration(generationID, provisionedBuffer)
+	if err != nil {
+		return err
+	}
+	genPath := gen.contentsPath(target)
+	genBuffer, err := NewFileBuffer(genPath, targetPath)
+	if err != nil {
+		return err
+	}
+
+	//restore the generation into the target and the provisioned copy (with the
+	//same attributes and checks as in `holo apply`)
+	meta, err := target.Meta()
+	if err != nil {
+		return err
+	}
+	tx := target.newTransaction()
+	defer tx.abort()
+	err = tx.writeFile(targetPath, genBuffer, target.prepareNewTarget(meta, genBuffer))
+	if err == nil {
+		err = tx.writeFile(provisionedPath, genBuffer, target.prepareNewProvisionedCopy(meta))
+	}
+	if err == nil {
+		err = tx.removeFile(target.PathIn(common.DeletedDirectory()))
+	}
+	if err != nil {
+		return err
+	}
+
+	//record the rollback like an adoption, so that `holo apply` keeps the
+	//restored generation until the desired state changes
+	buffer, err := target.render()
+	if err != nil {
+		return err
+	}
+	if buffer.Absent {
+		return errors.New("cannot roll back target: target is deleted by a repository file")
+	}
+	if buffer.EqualTo(genBuffer) {
+		err = tx.removeFile(target.PathIn(common.AdoptedDirectory()))
+	} else {
+		err = tx.writeFile(target.PathIn(common.AdoptedDirectory()), buffer, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.commit()
+	if err != nil {
+		return err
+	}
+	fmt.Printf(">> rolled back to generation %d (provisioned at %s)\n",
+		gen.ID, gen.Timestamp.Format("2006-01-02 15:04:05 MST"))
+	if len(gen.RepoFiles) > 0 {
+		fmt.Printf(">> generation %d was rendered from: %s\n", gen.ID, strings.Join(gen.RepoFiles, ", "))
+	}
+	return nil
+}
+
+//chooseGeneration finds the generation with the given ID. If generationID is 0,
+//the generation before the one matching the current provisioned state is
+//chosen.
+func (target *TargetFile) chooseGeneration(generationID int, provisionedBuffer *FileBuffer) (generation, error) {
+	gens, err := target.generations()
+	if err != nil {
+		return generation{}, err
+	}
+	if len(gens) == 0 {
+		return generation{}, errors.New("cannot roll back target: no generations recorded")
+	}
+
+	if generationID != 0 {
+		ids := make([]string, 0, len(gens))
+		for _, gen := range gens {
+			if gen.ID == generationID {
+				return gen, nil
+			}
+			ids = append(ids, strconv.Itoa(gen.ID))
+		}
+		return generation{}, fmt.Errorf("cannot roll back target: no generation %d (available: %s)",
+			generationID, strings.Join(ids, ", "))
+	}
+
+	//find the newest generation that matches the provisioned state
+	current := len(gens)
+	for idx := len(gens) - 1; idx >= 0; idx-- {
+		genBuffer, err := NewFileBuffer(gens[idx].contentsPath(target), provisionedBuffer.BasePath)
+		if err != nil {
+			return generation{}, err
+		}
+		if genBuffer.EqualTo(provisionedBuffer) {
+			current = idx
+			break
+		}
+	}
+	if current == 0 {
+		return generation{}, errors.New("cannot roll back target: no earlier generation recorded")
+	}
+	return gens[current-1], nil
+}
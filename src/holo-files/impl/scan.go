@@ -21,24 +21,41 @@
 package impl
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"../../lib/holo"
 	"../common"
 )
 
-//ScanRepo returns a slice of all the TargetFile entities.
-func ScanRepo() []*TargetFile {
+//RepoDirectory records the modification time of a directory in the
+//repository. Since adding or removing repo files changes the modification time
+//of the containing directory, this is used to detect stale scan results.
+type RepoDirectory struct {
+	Path    string
+	ModTime int64
+}
+
+//ScanRepo returns a slice of all the TargetFile entities, and the state of all
+//directories in the repository.
+func ScanRepo() ([]*TargetFile, []RepoDirectory) {
 	//walk over the repo to find repo files (and thus the corresponding target files)
 	targets := make(map[string]*TargetFile)
-	repoDir := common.ResourceDirectory()
+	var repoDirs []RepoDirectory
+	repoDir := holo.ResourceDirectory()
 	filepath.Walk(repoDir, func(repoPath string, repoFileInfo os.FileInfo, err error) error {
 		//skip over unaccessible stuff
 		if err != nil {
 			return err
 		}
+		//remember directories for the cache
+		if repoFileInfo.IsDir() {
+			repoDirs = append(repoDirs, RepoDirectory{repoPath, repoFileInfo.ModTime().UnixNano()})
+			return nil
+		}
 		//only look at manageable files (regular files or symlinks)
 		if !(repoFileInfo.Mode().IsRegular() || common.IsFileInfoASymbolicLink(repoFileInfo)) {
 			return nil
@@ -54,16 +71,30 @@ func ScanRepo() []*TargetFile {
 			return nil
 		}
 
-		//create new TargetFile if necessary and store the repo entry in it
+		//create new TargetFile if necessary and store the repo entry (or
+		//metadata sidecar file or validator) in it
 		repoEntry := NewRepoFile(repoPath)
 		targetPath := repoEntry.TargetPath()
 		if targets[targetPath] == nil {
-			targets[targetPath] = NewTargetFileFromPathIn(common.TargetDirectory(), targetPath)
+			targets[targetPath] = NewTargetFileFromPathIn(holo.TargetDirectory(), targetPath)
+		}
+		if isMetaFile(repoPath) {
+			targets[targetPath].AddMetaFile(repoPath)
+		} else if isValidatorFile(repoPath) {
+			targets[targetPath].AddValidator(repoPath)
+		} else {
+			targets[targetPath].AddRepoEntry(repoEntry)
 		}
-		targets[targetPath].AddRepoEntry(repoEntry)
 		return nil
 	})
 
+	//metadata sidecar files and validators alone do not make a target
+	for targetPath, target := range targets {
+		if len(target.repoEntries) == 0 {
+			delete(targets, targetPath)
+		}
+	}
+
 	//walk over the target base directory to find orphaned target bases
 	targetBaseDir := common.TargetBaseDirectory()
 	filepath.Walk(targetBaseDir, func(targetBasePath string, targetBaseFileInfo os.FileInfo, err error) error {
@@ -84,7 +115,7 @@ func ScanRepo() []*TargetFile {
 		//(if not, it's orphaned)
 		//TODO: s/(targetBase)Path/\1Dir/g and s/(targetBase)File/Path/g
 		target := NewTargetFileFromPathIn(targetBaseDir, targetBasePath)
-		targetPath := target.PathIn(common.TargetDirectory())
+		targetPath := target.PathIn(holo.TargetDirectory())
 		if targets[targetPath] == nil {
 			target.orphaned = true
 			targets[targetPath] = target
@@ -99,7 +130,19 @@ func ScanRepo() []*TargetFile {
 	}
 
 	sort.Sort(filesByPath(result))
-	return result
+
+	//validate the metadata sidecar files (invalid metadata is reported again
+	//when the target is applied)
+	for _, target := range result {
+		if len(target.metaFiles) > 0 {
+			_, err := target.Meta()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+			}
+		}
+	}
+
+	return result, repoDirs
 }
 
 type filesByPath []*TargetFile
@@ -26,20 +26,23 @@ import (
 	"path/filepath"
 	"sort"
 
+	"../../lib/holo"
 	"../common"
 )
 
 //TargetFile represents a configuration file that can be provisioned by Holo.
 type TargetFile struct {
-	relTargetPath string //the target path relative to the common.TargetDirectory()
+	relTargetPath string //the target path relative to the holo.TargetDirectory()
 	orphaned      bool   //default: false
 	repoEntries   RepoFiles
+	metaFiles     []string
+	validators    []string
 }
 
 //NewTargetFileFromPathIn creates a TargetFile instance for which a path
 //relative to a known location is known.
 //
-//    target := NewTargetFileFromPathIn(common.TargetDirectory(), targetPath)
+//    target := NewTargetFileFromPathIn(holo.TargetDirectory(), targetPath)
 //    target := NewTargetFileFromPathIn(common.ProvisionedDirectory(), provisionedPath)
 func NewTargetFileFromPathIn(directory, path string) *TargetFile {
 	//make path relative
@@ -49,7 +52,7 @@ func NewTargetFileFromPathIn(directory, path string) *TargetFile {
 
 //PathIn returns the path to this target file relative to the given directory.
 //
-//    targetPath := target.pathIn(common.TargetDirectory())           // e.g. "/etc/foo.conf"
+//    targetPath := target.pathIn(holo.TargetDirectory())           // e.g. "/etc/foo.conf"
 //    targetBasePath := target.pathIn(common.TargetBaseDirectory())   // e.g. "/var/lib/holo/files/base/etc/foo.conf"
 //    provisionedPath := target.pathIn(common.ProvisionedDirectory()) // e.g. "/var/lib/holo/files/provisioned/etc/foo.conf"
 //
@@ -71,34 +74,56 @@ func (target *TargetFile) RepoEntries() RepoFiles {
 
 //EntityID returns the entity ID for this target file.
 func (target *TargetFile) EntityID() string {
-	return target.PathIn(common.TargetDirectory())
+	return target.PathIn(holo.TargetDirectory())
 }
 
-//PrintReport prints the report required by the "scan" operation for this
-//target file.
-func (target *TargetFile) PrintReport() {
-	fmt.Printf("ENTITY: %s\n", target.EntityID())
+//Report implements the holo.Entity interface.
+func (target *TargetFile) Report() *holo.EntityReport {
+	r := holo.EntityReport{EntityID: target.EntityID()}
 
 	if target.orphaned {
 		_, strategy, assessment := target.scanOrphanedTargetBase()
-		fmt.Printf("ACTION: Scrubbing (%s)\n", assessment)
-		fmt.Printf("%s: %s\n", strategy, target.PathIn(common.TargetBaseDirectory()))
+		r.ActionVerb = "Scrubbing"
+		r.ActionReason = assessment
+		r.AddInfo(strategy, target.PathIn(common.TargetBaseDirectory()))
 	} else {
-		fmt.Printf("store at: %s\n", target.PathIn(common.TargetBaseDirectory()))
+		r.AddInfo("store at", target.PathIn(common.TargetBaseDirectory()))
 		for _, entry := range target.repoEntries {
-			fmt.Printf("%s: %s\n", entry.ApplicationStrategy(), entry.Path())
+			r.AddInfo(entry.ApplicationStrategy(), entry.Path())
+		}
+		for _, path := range target.metaFiles {
+			r.AddInfo("meta", path)
+		}
+		for _, path := range target.validators {
+			r.AddInfo("validate", path)
+		}
+		//show the mode and ownership requested by the metadata
+		if meta, err := target.Meta(); err == nil {
+			if meta.Mode != "" {
+				r.AddInfo("mode", meta.Mode)
+			}
+			if meta.Owner != "" {
+				r.AddInfo("owner", meta.Owner)
+			}
+			if meta.Group != "" {
+				r.AddInfo("group", meta.Group)
+			}
+			if meta.Validate != "" {
+				r.AddInfo("validate", meta.Validate)
+			}
 		}
 	}
+	return &r
 }
 
-//Apply implements the common.Entity interface.
-func (target *TargetFile) Apply(withForce bool) (skipReport bool) {
+//Apply performs the complete application algorithm for this target file.
+func (target *TargetFile) Apply(withForce, withMerge bool) (skipReport bool) {
 	var err error
 	if target.orphaned {
 		err = target.handleOrphanedTargetBase()
 		skipReport = false
 	} else {
-		skipReport, err = apply(target, withForce)
+		skipReport, err = apply(target, withForce, withMerge)
 	}
 
 	if err != nil {
@@ -0,0 +1,111 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"../../internal/toml"
+	"../../lib/holo"
+)
+
+//TemplateData is the data structure that `.holotemplate` repo files are
+//rendered with.
+type TemplateData struct {
+	//the contents of the file buffer (i.e. the target base or the result of
+	//the previous application step)
+	Contents string
+	//facts about the host system (see `holo facts`)
+	Facts map[string]string
+	//variables from the definition files (see templateVariables)
+	Vars map[string]interface{}
+}
+
+func applyTemplate(repoFile RepoFile, buffer *FileBuffer) (*FileBuffer, error) {
+	//this application strategy requires file contents
+	buffer, err := buffer.ResolveSymlink()
+	if err != nil {
+		return nil, err
+	}
+
+	//the template name appears in error messages, together with the line number
+	contents, err := ioutil.ReadFile(repoFile.Path())
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(repoFile.Path())).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("rendering of %s failed: %s", repoFile.Path(), err.Error())
+	}
+
+	vars, err := templateVariables()
+	if err != nil {
+		return nil, err
+	}
+	data := TemplateData{
+		Contents: string(buffer.Contents),
+		Facts:    holo.Facts(),
+		Vars:     vars,
+	}
+
+	//render into the buffer (not into the targetPath directly, in order not to
+	//corrupt the file there if rendering fails)
+	var result bytes.Buffer
+	err = tmpl.Execute(&result, data)
+	if err != nil {
+		return nil, fmt.Errorf("rendering of %s failed: %s", repoFile.Path(), err.Error())
+	}
+	return NewFileBufferFromContents(result.Bytes(), buffer.BasePath), nil
+}
+
+//templateVariables reads the variables that are available to templates as
+//{{.Vars.name}}. They are defined in TOML files directly inside the resource
+//directory (e.g. /usr/share/holo/files/23-foo.toml). The definition files are
+//read in alphabetical order, and later definitions override earlier ones.
+func templateVariables() (map[string]interface{}, error) {
+	paths, err := filepath.Glob(filepath.Join(holo.ResourceDirectory(), "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	vars := make(map[string]interface{})
+	for _, path := range paths {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fileVars map[string]interface{}
+		_, err = toml.Decode(string(blob), &fileVars)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", path, err.Error())
+		}
+		for key, value := range fileVars {
+			vars[key] = value
+		}
+	}
+	return vars, nil
+}
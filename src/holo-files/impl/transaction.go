@@ -0,0 +1,288 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"../../lib/holo"
+	"../common"
+)
+
+//transaction collects the changes to a target and its state files (the
+//provisioned copy and the marker files), so that they can be made all at once
+//by commit(). New file contents are written into temporary files first. When
+//all of them are complete, a journal entry is written that lists the pending
+//changes, and then the changes are made. If Holo is interrupted while making
+//the changes, recoverTransactions() completes them using the journal entry
+//(and if Holo is interrupted before the journal entry was complete, nothing
+//has been changed except for the temporary files).
+type transaction struct {
+	target  *TargetFile
+	changes []journalChange
+	//set by commit() once the journal entry has been written (from then on,
+	//the temporary files are needed to complete the changes)
+	committed bool
+}
+
+//journalChange is a single change in a transaction.
+type journalChange struct {
+	//one of "rename", "remove" or "create"
+	action string
+	//the path of the file that is changed (relative to holo.TargetDirectory())
+	path string
+	//for "rename": the temporary file that replaces the file at path (relative
+	//to holo.TargetDirectory())
+	tempPath string
+}
+
+//newTransaction starts a transaction for this target.
+func (target *TargetFile) newTransaction() *transaction {
+	return &transaction{target: target}
+}
+
+//writeFile schedules the replacement of the file at the given path with the
+//contents of the given buffer. The buffer is written into a temporary file
+//immediately, and prepare() is called with the path of the temporary file to
+//apply file metadata (if prepare is not nil).
+func (tx *transaction) writeFile(path string, buffer *FileBuffer, prepare func(tempPath string) error) error {
+	if buffer.Absent {
+		return tx.removeFile(path)
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".holonew"
+	err = buffer.Write(tempPath)
+	if err == nil && prepare != nil {
+		err = prepare(tempPath)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath) //this can fail silently
+		return err
+	}
+	return tx.add("rename", path, tempPath)
+}
+
+//removeFile schedules the removal of the file at the given path (if it exists).
+func (tx *transaction) removeFile(path string) error {
+	return tx.add("remove", path, "")
+}
+
+//createFile schedules the creation of an empty file at the given path (e.g.
+//for marker files like the ones below common.DeletedDirectory()).
+func (tx *transaction) createFile(path string) error {
+	return tx.add("create", path, "")
+}
+
+func (tx *transaction) add(action, path, tempPath string) error {
+	//paths are stored relative to the target directory, so that the journal
+	//entry is valid regardless of the working directory
+	var err error
+	path, err = relativeToTargetDirectory(path)
+	if err != nil {
+		return err
+	}
+	if tempPath != "" {
+		tempPath, err = relativeToTargetDirectory(tempPath)
+		if err != nil {
+			return err
+		}
+	}
+	tx.changes = append(tx.changes, journalChange{action, path, tempPath})
+	return nil
+}
+
+func relativeToTargetDirectory(path string) (string, error) {
+	rootDir, err := filepath.Abs(holo.TargetDirectory())
+	if err != nil {
+		return "", err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(rootDir, path)
+}
+
+//commit makes all changes in this transaction.
+func (tx *transaction) commit() error {
+	if len(tx.changes) == 0 {
+		return nil
+	}
+
+	//write the journal entry (into a temporary file first, so that an
+	//incomplete journal entry is never mistaken for a complete one)
+	journalPath := tx.target.PathIn(common.JournalDirectory())
+	var journal bytes.Buffer
+	for _, change := range tx.changes {
+		journal.WriteString(change.String())
+	}
+	err := common.WriteFileAtomically(journalPath, journal.Bytes())
+	if err != nil {
+		tx.abort()
+		return fmt.Errorf("cannot write journal entry %s: %s", journalPath, err.Error())
+	}
+	tx.committed = true
+
+	//make the changes, then forget about them
+	return replayJournal(journalPath, tx.changes)
+}
+
+//abort discards the changes in this transaction by removing their temporary
+//files. This does nothing when the transaction has been committed already, so
+//it can be deferred right after starting the transaction.
+func (tx *transaction) abort() {
+	if tx.committed {
+		return
+	}
+	rootDir := holo.TargetDirectory()
+	for _, change := range tx.changes {
+		if change.action == "rename" {
+			_ = os.Remove(filepath.Join(rootDir, change.tempPath)) //this can fail silently
+		}
+	}
+	tx.changes = nil
+}
+
+//String serializes this change into a line of a journal entry.
+func (change journalChange) String() string {
+	line := change.action + "\t" + strconv.Quote(change.path)
+	if change.tempPath != "" {
+		line += "\t" + strconv.Quote(change.tempPath)
+	}
+	return line + "\n"
+}
+
+//parseJournal parses a journal entry written by transaction.commit().
+func parseJournal(journalPath string) ([]journalChange, error) {
+	contents, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	var changes []journalChange
+	for _, line := range strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		var change journalChange
+		change.action = fields[0]
+		switch {
+		case (change.action == "remove" || change.action == "create") && len(fields) == 2:
+		case change.action == "rename" && len(fields) == 3:
+			change.tempPath, err = strconv.Unquote(fields[2])
+		default:
+			err = errors.New("invalid change")
+		}
+		if err == nil {
+			change.path, err = strconv.Unquote(fields[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse journal entry %s: %s in line %q", journalPath, err.Error(), line)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+//replayJournal makes the changes listed in a journal entry, then removes the
+//journal entry. Since the changes may have been made partially before,
+//changes that have already been made are skipped.
+func replayJournal(journalPath string, changes []journalChange) error {
+	rootDir := holo.TargetDirectory()
+	for _, change := range changes {
+		path := filepath.Join(rootDir, change.path)
+		tempPath := filepath.Join(rootDir, change.tempPath)
+		var err error
+		changed := true
+		switch change.action {
+		case "rename":
+			//if the temporary file is gone, it has been renamed already
+			changed = common.IsManageableFile(tempPath)
+			if changed {
+				err = os.Rename(tempPath, path)
+			}
+		case "remove":
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				changed, err = false, nil
+			}
+		case "create":
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = common.WriteFileSynced(path, nil, 0644)
+			}
+		}
+		if err == nil && changed {
+			err = common.SyncDirectory(filepath.Dir(path))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.Remove(journalPath)
+	if err != nil {
+		return err
+	}
+	err = common.SyncDirectory(filepath.Dir(journalPath))
+	if err != nil {
+		return err
+	}
+	return common.PruneEmptyDirectories(journalPath, common.JournalDirectory())
+}
+
+//pendingJournals returns the paths of all journal entries that were left
+//behind by interrupted transactions.
+func pendingJournals() []string {
+	var result []string
+	filepath.Walk(common.JournalDirectory(), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() && !strings.HasSuffix(path, ".holonew") {
+			result = append(result, path)
+		}
+		return nil
+	})
+	return result
+}
+
+//recoverTransactions completes all transactions that were interrupted (e.g.
+//by a crash or power loss) while their changes were being made.
+func recoverTransactions() error {
+	for _, journalPath := range pendingJournals() {
+		changes, err := parseJournal(journalPath)
+		if err != nil {
+			return err
+		}
+		err = replayJournal(journalPath, changes)
+		if err != nil {
+			return fmt.Errorf("cannot complete interrupted changes from %s: %s", journalPath, err.Error())
+		}
+		target := NewTargetFileFromPathIn(common.JournalDirectory(), journalPath)
+		fmt.Printf(">> completed interrupted changes to %s\n", target.PathIn(holo.TargetDirectory()))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+//diffContext is the number of unchanged lines shown around each change in a
+//unified diff.
+const diffContext = 3
+
+//diffLine is a line in a unified diff. The kind is ' ' for unchanged lines,
+//'-' for removed lines and '+' for added lines.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+//diffLines computes the shortest edit script that turns the lines of a into
+//the lines of b, using the linear-space variant of the algorithm from E. Myers,
+//"An O(ND) Difference Algorithm and Its Variations" (1986). Within each block
+//of changes, removed lines are sorted before added lines.
+func diffLines(a, b []string) []diffLine {
+	script := appendEditScript(nil, a, b)
+
+	//put removals before additions in each block of changes
+	result := make([]diffLine, 0, len(script))
+	var added []diffLine
+	for _, line := range script {
+		switch line.kind {
+		case '+':
+			added = append(added, line)
+		case '-':
+			result = append(result, line)
+		default:
+			result = append(append(result, added...), line)
+			added = added[:0]
+		}
+	}
+	return append(result, added...)
+}
+
+//appendEditScript appends the shortest edit script that turns a into b to the
+//given edit script. The problem is divided at the middle snake of an optimal
+//path, so that only linear space is needed.
+func appendEditScript(script []diffLine, a, b []string) []diffLine {
+	//common prefixes and suffixes are not part of the middle snake search
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		script = append(script, diffLine{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffixLength := 0
+	for suffixLength < len(a) && suffixLength < len(b) && a[len(a)-1-suffixLength] == b[len(b)-1-suffixLength] {
+		suffixLength++
+	}
+	suffix := a[len(a)-suffixLength:]
+	a, b = a[:len(a)-suffixLength], b[:len(b)-suffixLength]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			script = append(script, diffLine{'+', line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			script = append(script, diffLine{'-', line})
+		}
+	default:
+		//since a and b are not empty and have no common prefix or suffix, the
+		//edit script has at least two steps, so both halves are smaller than
+		//the whole problem
+		x, y, u, v := middleSnake(a, b)
+		script = appendEditScript(script, a[:x], b[:y])
+		for _, line := range a[x:u] {
+			script = append(script, diffLine{' ', line})
+		}
+		script = appendEditScript(script, a[u:], b[v:])
+	}
+
+	for _, line := range suffix {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+//middleSnake finds the snake in the middle of a shortest edit script that
+//turns a into b, by searching for furthest reaching paths from both ends at
+//the same time until they overlap. The snake goes from (x,y) to (u,v).
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	//forward[offset+k] is the furthest x on diagonal k = x - y from the
+	//start, backward[offset+k] is the same for the reversed inputs
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			//diagonal k corresponds to diagonal delta-k in the reversed inputs
+			if delta%2 != 0 && delta-k >= -(d-1) && delta-k <= d-1 && x+backward[offset+delta-k] >= n {
+				return startX, startY, x, y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if delta%2 == 0 && delta-k >= -d && delta-k <= d && x+forward[offset+delta-k] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+
+	//unreachable: the paths overlap after at most (n+m+1)/2 steps each
+	panic("middleSnake: no overlap found")
+}
+
+//writeHunks renders the given edit script as the hunks of a unified diff.
+//Changes that are close to each other are grouped into one hunk, like
+//diff(1) does.
+func writeHunks(out *bytes.Buffer, lines []diffLine) {
+	//oldLine[i] and newLine[i] count the lines before lines[i] in the old and
+	//new file, respectively
+	oldLine := make([]int, len(lines)+1)
+	newLine := make([]int, len(lines)+1)
+	for idx, line := range lines {
+		oldLine[idx+1], newLine[idx+1] = oldLine[idx], newLine[idx]
+		if line.kind != '+' {
+			oldLine[idx+1]++
+		}
+		if line.kind != '-' {
+			newLine[idx+1]++
+		}
+	}
+
+	idx := 0
+	for {
+		//find the start of the next hunk's first change
+		start := idx
+		for start < len(lines) && lines[start].kind == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			return
+		}
+
+		//find the end of the hunk's last change (changes are merged into one hunk
+		//if their contexts would overlap or touch)
+		end := start
+		for {
+			for end < len(lines) && lines[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].kind == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+
+		//add context around the changes
+		start -= diffContext
+		if start < idx {
+			start = idx
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n",
+			formatHunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			formatHunkRange(newLine[start], newLine[end]-newLine[start]),
+		)
+		for _, line := range lines[start:end] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		idx = end
+	}
+}
+
+//formatHunkRange formats a line range for a hunk header, given the number of
+//lines before the range, and the number of lines in the range.
+func formatHunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"../../lib/holo"
+)
+
+//validatorSuffix is the suffix of executables in the repository that validate
+//the result for a target before it is written (e.g.
+//"/usr/share/holo/files/20-foo/etc/sudoers.holovalidate").
+const validatorSuffix = ".holovalidate"
+
+//isValidatorFile returns whether the given repo path is a `.holovalidate`
+//executable.
+func isValidatorFile(repoPath string) bool {
+	return strings.HasSuffix(repoPath, validatorSuffix)
+}
+
+//AddValidator registers a `.holovalidate` executable in this TargetFile
+//instance.
+func (target *TargetFile) AddValidator(path string) {
+	target.validators = append(target.validators, path)
+}
+
+//validatorCommand returns the command line for the validator given in the
+//metadata, with the given path in place of "%s" (or appended to the command
+//line if there is no "%s").
+func (meta TargetMeta) validatorCommand(path string) ([]string, error) {
+	words := strings.Fields(meta.Validate)
+	if len(words) == 0 {
+		return nil, errors.New("empty validator")
+	}
+	hasPlaceholder := false
+	for idx, word := range words {
+		if strings.Contains(word, "%s") {
+			words[idx] = strings.Replace(word, "%s", path, -1)
+			hasPlaceholder = true
+		}
+	}
+	if !hasPlaceholder {
+		words = append(words, path)
+	}
+	return words, nil
+}
+
+//validate runs all validators for this target on the file at the given path,
+//which contains the result that is about to be written to the target. If a
+//validator fails, its output is shown and an error is returned.
+func (target *TargetFile) validate(path string, meta TargetMeta) error {
+	sort.Strings(target.validators)
+	var commands [][]string
+	for _, validator := range target.validators {
+		commands = append(commands, []string{validator, path})
+	}
+	if meta.Validate != "" {
+		command, err := meta.validatorCommand(path)
+		if err != nil {
+			return err
+		}
+		commands = append(commands, command)
+	}
+
+	for _, command := range commands {
+		var output bytes.Buffer
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		cmd.Env = append(os.Environ(), "HOLO_TARGET_PATH="+target.PathIn(holo.TargetDirectory()))
+		err := cmd.Run()
+		if err != nil {
+			reportOutput("output of "+command[0], output.Bytes())
+			return fmt.Errorf("validation by %s failed: %s", command[0], err.Error())
+		}
+	}
+	return nil
+}
@@ -21,9 +21,7 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
+	"../lib/holo"
 	"./impl"
 )
 
@@ -37,59 +35,5 @@ func init() {
 }
 
 func main() {
-	if version := os.Getenv("HOLO_API_VERSION"); version != "1" {
-		fmt.Fprintf(os.Stderr, "!! holo-users-groups plugin called with unknown HOLO_API_VERSION %s\n", version)
-	}
-
-	//scan for entities
-	entities := impl.ScanRepo()
-	if entities == nil {
-		//some fatal error occurred - it was already reported, so just exit
-		os.Exit(1)
-	}
-
-	//scan action requires no arguments
-	if os.Args[1] == "scan" {
-		for _, entity := range entities {
-			entity.PrintReport()
-		}
-		return
-	}
-
-	//all other actions require an entity selection
-	entityID := os.Args[2]
-	var selectedEntity *impl.TargetFile
-	for _, entity := range entities {
-		if entity.EntityID() == entityID {
-			selectedEntity = entity
-			break
-		}
-	}
-	if selectedEntity == nil {
-		fmt.Fprintf(os.Stderr, "!! unknown entity ID \"%s\"\n", entityID)
-		os.Exit(1)
-	}
-
-	switch os.Args[1] {
-	case "apply":
-		applyEntity(selectedEntity, false)
-	case "force-apply":
-		applyEntity(selectedEntity, true)
-	case "diff":
-		output, err := selectedEntity.RenderDiff()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		}
-		os.Stdout.Write(output)
-	}
-}
-
-func applyEntity(entity *impl.TargetFile, withForce bool) {
-	skipReport := entity.Apply(withForce)
-	if skipReport {
-		_, err := os.NewFile(3, "file descriptor 3").Write([]byte("not changed\n"))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		}
-	}
+	holo.Main(&impl.FilesPlugin{})
 }
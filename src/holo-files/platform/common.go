@@ -38,7 +38,9 @@ type Impl interface {
 	//modified by Holo, it will usually place the new stock configuration next
 	//to the targetPath (usually with a special suffix). If such a file exists,
 	//this method must return its name, so that Holo can pick it up and use it
-	//as a new base configuration.
+	//as a new base configuration. If the package manager leaves multiple
+	//updated versions, this method must return the newest one (and may remove
+	//the others, since they are obsolete).
 	//
 	//The reportedPath is usually the same as the actualPath, but some
 	//implementations have to move files around, in which case the reportedPath
@@ -65,12 +67,16 @@ func init() {
 	//which distribution are we running on?
 	isDist := GetCurrentDistribution()
 	switch {
+	case isDist["alpine"]:
+		impl = apkImpl{}
 	case isDist["arch"]:
 		impl = archImpl{}
 	case isDist["debian"]:
 		impl = dpkgImpl{}
 	case isDist["fedora"], isDist["suse"]:
 		impl = rpmImpl{}
+	case isDist["gentoo"]:
+		impl = gentooImpl{}
 	case isDist["unittest"]:
 		//set via HOLO_CURRENT_DISTRIBUTION=unittest only
 		impl = genericImpl{}
@@ -87,6 +93,9 @@ func GetCurrentDistribution() map[string]bool {
 	if value := os.Getenv("HOLO_CURRENT_DISTRIBUTION"); value != "" {
 		return map[string]bool{value: true}
 	}
+	//NOTE: $HOLO_FACT_DISTRIBUTION is deliberately not used here since custom
+	//facts can override it, and the platform integration must not depend on
+	//user-provided data
 
 	//read /etc/os-release, fall back to /usr/lib/os-release if not available
 	bytes, err := ioutil.ReadFile("/etc/os-release")
@@ -0,0 +1,99 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"../common"
+)
+
+//gentooImpl provides the platform.Impl for Gentoo and derivatives.
+type gentooImpl struct{}
+
+//FindUpdatedTargetBase implements the platform.Impl interface. Because of
+//CONFIG_PROTECT, Portage places updated configuration files next to the target
+//as "._cfgNNNN_$name", with a counter that increases for each pending update.
+//The highest-numbered file is the most recent target base, so all others are
+//obsolete and can be removed.
+func (p gentooImpl) FindUpdatedTargetBase(targetPath string) (actualPath, reportedPath string, err error) {
+	paths, err := pendingConfigUpdates(targetPath)
+	if err != nil || len(paths) == 0 {
+		return "", "", err
+	}
+
+	newestPath := paths[len(paths)-1]
+	obsoletePaths := paths[:len(paths)-1]
+	for _, path := range obsoletePaths {
+		err := os.Remove(path)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if len(obsoletePaths) > 0 {
+		reportedPath = fmt.Sprintf("%s (superseding %s)", newestPath, strings.Join(obsoletePaths, ", "))
+		return newestPath, reportedPath, nil
+	}
+	return newestPath, newestPath, nil
+}
+
+func (p gentooImpl) AdditionalCleanupTargets(targetPath string) []string {
+	//pending updates for a removed package are not useful anymore
+	paths, err := pendingConfigUpdates(targetPath)
+	if err != nil {
+		return nil
+	}
+	return paths
+}
+
+//pendingConfigUpdates returns the paths of all "._cfgNNNN_$name" files for the
+//given target, sorted by their counter (i.e. from oldest to newest).
+func pendingConfigUpdates(targetPath string) ([]string, error) {
+	dirPath, name := filepath.Split(targetPath)
+	if dirPath == "" {
+		dirPath = "."
+	}
+	infos, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	//the counter always has four digits, so sorting the file names is enough
+	pattern := regexp.MustCompile(`^\._cfg[0-9]{4}_` + regexp.QuoteMeta(name) + `$`)
+	var result []string
+	for _, info := range infos {
+		path := filepath.Join(dirPath, info.Name())
+		if pattern.MatchString(info.Name()) && common.IsManageableFile(path) {
+			result = append(result, path)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
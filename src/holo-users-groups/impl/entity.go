@@ -20,18 +20,13 @@
 
 package impl
 
+import "../../lib/holo"
+
 //Entity provides a common interface for configuration entities, such as
-//configuration files, user accounts and user groups.
+//configuration files, user accounts and user groups. On top of the holo.Entity
+//interface, it contains the methods needed by the UsersGroupsPlugin.
 type Entity interface {
-	//EntityID returns a string that uniquely identifies the entity, usually in
-	//the form "type:name". This is how the entity can be addressed as a target
-	//in the argument list for "holo apply", e.g. "holo apply /etc/sudoers
-	//group:foo" will apply the target file "/etc/sudoers" and the group "foo".
-	//Therefore, entity IDs should not contain whitespaces or characters that
-	//have a special meaning on the shell.
-	EntityID() string
-	//PrintReport prints the scan report for this entity on stdout.
-	PrintReport()
+	holo.Entity
 	//Apply performs the complete application algorithm for the given Entity.
 	Apply(withForce bool) (entityWasChanged bool)
 	//RenderDiff creates a unified diff between the current and last
@@ -26,6 +26,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"../../lib/holo"
 )
 
 //Group represents a UNIX group (as registered in /etc/group). It implements
@@ -50,15 +52,16 @@ func (g *Group) setInvalid() { g.broken = true }
 //EntityID implements the Entity interface for Group.
 func (g Group) EntityID() string { return "group:" + g.Name }
 
-//PrintReport implements the Entity interface for Group.
-func (g Group) PrintReport() {
-	fmt.Printf("ENTITY: %s\n", g.EntityID())
+//Report implements the Entity interface for Group.
+func (g Group) Report() *holo.EntityReport {
+	r := holo.EntityReport{EntityID: g.EntityID()}
 	for _, defFile := range g.DefinitionFiles {
-		fmt.Printf("found in: %s\n", defFile)
+		r.AddInfo("found in", defFile)
 	}
 	if attributes := g.attributes(); attributes != "" {
-		fmt.Printf("with: %s\n", attributes)
+		r.AddInfo("with", attributes)
 	}
+	return &r
 }
 
 func (g Group) attributes() string {
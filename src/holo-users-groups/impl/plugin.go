@@ -0,0 +1,107 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package impl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"../../internal/toml"
+	"../../lib/holo"
+)
+
+//UsersGroupsPlugin implements the holo.CachingPlugin interface for user
+//accounts and groups.
+type UsersGroupsPlugin struct{}
+
+type cache struct {
+	Groups []Group
+	Users  []User
+}
+
+func pathToCacheFile() string {
+	return filepath.Join(holo.CacheDirectory(), "entities.toml")
+}
+
+//Scan implements the holo.Plugin interface.
+func (p UsersGroupsPlugin) Scan() []holo.Entity {
+	groups, users := Scan()
+	if groups == nil && users == nil {
+		return nil
+	}
+	return (&cache{groups, users}).entities()
+}
+
+//Apply implements the holo.Plugin interface.
+func (p UsersGroupsPlugin) Apply(entity holo.Entity, withForce bool) bool {
+	return entity.(Entity).Apply(withForce)
+}
+
+//Diff implements the holo.Plugin interface.
+func (p UsersGroupsPlugin) Diff(entity holo.Entity) ([]byte, error) {
+	return entity.(Entity).RenderDiff()
+}
+
+//StoreCache implements the holo.CachingPlugin interface.
+func (p UsersGroupsPlugin) StoreCache(entities []holo.Entity) error {
+	var data cache
+	for _, entity := range entities {
+		switch entity := entity.(type) {
+		case Group:
+			data.Groups = append(data.Groups, entity)
+		case User:
+			data.Users = append(data.Users, entity)
+		}
+	}
+
+	file, err := os.Create(pathToCacheFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return toml.NewEncoder(file).Encode(&data)
+}
+
+//LoadCache implements the holo.CachingPlugin interface.
+func (p UsersGroupsPlugin) LoadCache() ([]holo.Entity, error) {
+	blob, err := ioutil.ReadFile(pathToCacheFile())
+	if err != nil {
+		return nil, err
+	}
+	var data cache
+	_, err = toml.Decode(string(blob), &data)
+	if err != nil {
+		return nil, err
+	}
+	return data.entities(), nil
+}
+
+func (c *cache) entities() []holo.Entity {
+	result := make([]holo.Entity, 0, len(c.Groups)+len(c.Users))
+	for _, group := range c.Groups {
+		result = append(result, group)
+	}
+	for _, user := range c.Users {
+		result = append(result, user)
+	}
+	return result
+}
@@ -29,13 +29,14 @@ import (
 	"strings"
 
 	"../../internal/toml"
+	"../../lib/holo"
 )
 
 //Scan returns a slice of all the defined entities. If an error is encountered
 //during the scan, it will be reported on stderr, and nil is returned.
 func Scan() ([]Group, []User) {
 	//open resource directory
-	dirPath := os.Getenv("HOLO_RESOURCE_DIR")
+	dirPath := holo.ResourceDirectory()
 	dir, err := os.Open(dirPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
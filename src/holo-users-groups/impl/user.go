@@ -27,6 +27,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"../../lib/holo"
 )
 
 //User represents a UNIX user account (as registered in /etc/passwd). It
@@ -56,15 +58,16 @@ func (u *User) setInvalid() { u.broken = true }
 //EntityID implements the Entity interface for User.
 func (u User) EntityID() string { return "user:" + u.Name }
 
-//PrintReport implements the Entity interface for User.
-func (u User) PrintReport() {
-	fmt.Printf("ENTITY: %s\n", u.EntityID())
+//Report implements the Entity interface for User.
+func (u User) Report() *holo.EntityReport {
+	r := holo.EntityReport{EntityID: u.EntityID()}
 	for _, defFile := range u.DefinitionFiles {
-		fmt.Printf("found in: %s\n", defFile)
+		r.AddInfo("found in", defFile)
 	}
 	if attributes := u.attributes(); attributes != "" {
-		fmt.Printf("with: %s\n", attributes)
+		r.AddInfo("with", attributes)
 	}
+	return &r
 }
 
 func (u User) attributes() string {
@@ -27,6 +27,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"../../lib/holo"
 )
 
 //Getent reads entries from a UNIX user/group database (e.g. /etc/passwd
@@ -57,12 +59,10 @@ func Getent(databaseFile string, predicate func([]string) bool) ([]string, error
 	return nil, nil
 }
 
-var rootDir string
 var mock bool
 
 func init() {
-	rootDir = os.Getenv("HOLO_ROOT_DIR")
-	mock = rootDir != ""
+	mock = os.Getenv("HOLO_ROOT_DIR") != ""
 }
 
 //GetPath converts a given path that is relative to the root directory, into
@@ -71,7 +71,7 @@ func init() {
 //    GetPath("etc/group") = "/etc/group"                   # normally
 //    GetPath("etc/group") = "/path/to/testcase/etc/group") # in testing mode
 func GetPath(path string) string {
-	return filepath.Join(rootDir, path)
+	return filepath.Join(holo.TargetDirectory(), path)
 }
 
 //ExecProgramOrMock is a wrapper around exec.Command().Run() that, if run in a
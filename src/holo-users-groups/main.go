@@ -21,120 +21,10 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-
-	"../internal/toml"
+	"../lib/holo"
 	"./impl"
 )
 
 func main() {
-	if version := os.Getenv("HOLO_API_VERSION"); version != "1" {
-		fmt.Fprintf(os.Stderr, "!! holo-users-groups plugin called with unknown HOLO_API_VERSION %s\n", version)
-	}
-
-	if os.Args[1] == "scan" {
-		executeScanCommand()
-	} else {
-		executeNonScanCommand()
-	}
-}
-
-type cache struct {
-	Groups []impl.Group
-	Users  []impl.User
-}
-
-func pathToCacheFile() string {
-	return filepath.Join(os.Getenv("HOLO_CACHE_DIR"), "entities.toml")
-}
-
-func executeScanCommand() {
-	//scan for entities
-	groups, users := impl.Scan()
-	if groups == nil && users == nil {
-		//some fatal error occurred - it was already reported, so just exit
-		os.Exit(1)
-	}
-
-	//print reports
-	for _, group := range groups {
-		group.PrintReport()
-	}
-	for _, user := range users {
-		user.PrintReport()
-	}
-
-	//store scan result in cache
-	file, err := os.Create(pathToCacheFile())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		os.Exit(1)
-	}
-	err = toml.NewEncoder(file).Encode(&cache{groups, users})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		os.Exit(1)
-	}
-	file.Close()
-}
-
-func executeNonScanCommand() {
-	//retrieve entities from cache
-	blob, err := ioutil.ReadFile(pathToCacheFile())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		os.Exit(1)
-	}
-	var cacheData cache
-	_, err = toml.Decode(string(blob), &cacheData)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		os.Exit(1)
-	}
-
-	//all other actions require an entity selection
-	entityID := os.Args[2]
-	var selectedEntity impl.Entity
-	for _, group := range cacheData.Groups {
-		if group.EntityID() == entityID {
-			selectedEntity = group
-			break
-		}
-	}
-	for _, user := range cacheData.Users {
-		if user.EntityID() == entityID {
-			selectedEntity = user
-			break
-		}
-	}
-	if selectedEntity == nil {
-		fmt.Fprintf(os.Stderr, "!! unknown entity ID \"%s\"\n", entityID)
-		os.Exit(1)
-	}
-
-	switch os.Args[1] {
-	case "apply":
-		applyEntity(selectedEntity, false)
-	case "force-apply":
-		applyEntity(selectedEntity, true)
-	case "diff":
-		output, err := selectedEntity.RenderDiff()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		}
-		os.Stdout.Write(output)
-	}
-}
-
-func applyEntity(entity impl.Entity, withForce bool) {
-	entityHasChanged := entity.Apply(withForce)
-	if !entityHasChanged {
-		_, err := os.NewFile(3, "file descriptor 3").Write([]byte("not changed\n"))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
-		}
-	}
+	holo.Main(impl.UsersGroupsPlugin{})
 }
@@ -23,6 +23,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"./plugins"
 )
@@ -42,9 +44,19 @@ var version = "v0.10.0-pre"
 
 const (
 	optionApplyForce = iota
+	optionApplyMerge
 	optionScanShort
+	optionDiffColor
+	optionDiffWordDiff
+	optionAdoptExport
+	optionAdoptPatch
+	optionRollbackTo
 )
 
+//optionValues holds the arguments of options that take an argument (like
+//"--export=DIR"), indexed like the options map.
+var optionValues = make(map[int]string)
+
 func main() {
 	//a command word must be given as first argument
 	if len(os.Args) < 2 {
@@ -55,15 +67,35 @@ func main() {
 	//check that it is a known command word
 	var command func([]*plugins.Entity, map[int]bool)
 	knownOpts := make(map[string]int)
+	knownValueOpts := make(map[string]int)
+	needsSelection := false
 	switch os.Args[1] {
 	case "apply":
 		command = commandApply
-		knownOpts = map[string]int{"-f": optionApplyForce, "--force": optionApplyForce}
+		knownOpts = map[string]int{"-f": optionApplyForce, "--force": optionApplyForce, "--merge": optionApplyMerge}
 	case "diff":
 		command = commandDiff
+		knownOpts = map[string]int{"--color": optionDiffColor, "--word-diff": optionDiffWordDiff}
+	case "adopt":
+		command = commandAdopt
+		knownOpts = map[string]int{"--patch": optionAdoptPatch}
+		knownValueOpts = map[string]int{"--export": optionAdoptExport}
+		needsSelection = true
+	case "rollback":
+		command = commandRollback
+		knownValueOpts = map[string]int{"--to": optionRollbackTo}
+		needsSelection = true
 	case "scan":
 		command = commandScan
 		knownOpts = map[string]int{"-s": optionScanShort, "--short": optionScanShort}
+	case "facts":
+		//does not work on entities
+		commandFacts(os.Args[2:])
+		return
+	case "doctor":
+		//does not work on entities, and shall work even with a broken holorc
+		commandDoctor(os.Args[2:])
+		return
 	case "version", "--version":
 		fmt.Println(version)
 		return
@@ -102,12 +134,32 @@ func main() {
 	hasUnrecognizedArgs := false
 
 	args := os.Args[2:]
-	for _, arg := range args {
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
 		//either it's a known option for this subcommand...
 		if value, ok := knownOpts[arg]; ok {
 			options[value] = true
 			continue
 		}
+		//...or a known option with an argument ("--opt=value" or "--opt value")...
+		if value, ok := knownValueOpts[arg]; ok {
+			if idx+1 == len(args) {
+				fmt.Fprintf(os.Stderr, "Missing argument for option: %s\n", arg)
+				hasUnrecognizedArgs = true
+				continue
+			}
+			idx++
+			options[value] = true
+			optionValues[value] = args[idx]
+			continue
+		}
+		if fields := strings.SplitN(arg, "=", 2); len(fields) == 2 {
+			if value, ok := knownValueOpts[fields[0]]; ok {
+				options[value] = true
+				optionValues[value] = fields[1]
+				continue
+			}
+		}
 		//...or it must be an entity ID
 		if isEntityID[arg] {
 			isEntityIDSelected[arg] = true
@@ -119,6 +171,10 @@ func main() {
 	if hasUnrecognizedArgs {
 		os.Exit(255)
 	}
+	if needsSelection && len(isEntityIDSelected) == 0 {
+		fmt.Fprintf(os.Stderr, "No entities selected (%s %s requires explicit entity IDs)\n", os.Args[0], os.Args[1])
+		os.Exit(255)
+	}
 
 	//if entities have been selected, limit the entities slice to these
 	if len(isEntityIDSelected) > 0 {
@@ -141,19 +197,78 @@ func main() {
 func commandHelp() {
 	program := os.Args[0]
 	fmt.Printf("Usage: %s <operation> [...]\nOperations:\n", program)
-	fmt.Printf("    %s apply [-f|--force] [entity ...]\n", program)
-	fmt.Printf("    %s diff [entity ...]\n", program)
+	fmt.Printf("    %s adopt [--export=DIR] [--patch] entity ...\n", program)
+	fmt.Printf("    %s apply [-f|--force|--merge] [entity ...]\n", program)
+	fmt.Printf("    %s diff [--color] [--word-diff] [entity ...]\n", program)
+	fmt.Printf("    %s doctor [--repair]\n", program)
+	fmt.Printf("    %s facts\n", program)
+	fmt.Printf("    %s rollback [--to=N] entity ...\n", program)
 	fmt.Printf("    %s scan [-s|--short] [entity ...]\n", program)
 	fmt.Printf("\nSee `man 8 holo` for details.\n")
 }
 
 func commandApply(entities []*plugins.Entity, options map[int]bool) {
-	withForce := options[optionApplyForce]
+	if options[optionApplyForce] && options[optionApplyMerge] {
+		fmt.Fprintf(os.Stderr, "Cannot use --force and --merge together\n")
+		plugins.CleanupRuntimeCache()
+		os.Exit(255)
+	}
+	plugins.ApplyEntities(entities, options[optionApplyForce], options[optionApplyMerge])
+}
+
+func commandAdopt(entities []*plugins.Entity, options map[int]bool) {
+	if options[optionAdoptPatch] && !options[optionAdoptExport] {
+		fmt.Fprintf(os.Stderr, "Cannot use --patch without --export\n")
+		plugins.CleanupRuntimeCache()
+		os.Exit(255)
+	}
+	for _, entity := range entities {
+		entity.Adopt(optionValues[optionAdoptExport], options[optionAdoptPatch])
+	}
+}
+
+func commandRollback(entities []*plugins.Entity, options map[int]bool) {
+	if options[optionRollbackTo] {
+		generation, err := strconv.Atoi(optionValues[optionRollbackTo])
+		if err != nil || generation < 1 {
+			fmt.Fprintf(os.Stderr, "Invalid generation for --to: %s\n", optionValues[optionRollbackTo])
+			plugins.CleanupRuntimeCache()
+			os.Exit(255)
+		}
+	}
 	for _, entity := range entities {
-		entity.Apply(withForce)
+		entity.Rollback(optionValues[optionRollbackTo])
 	}
 }
 
+func commandDoctor(args []string) {
+	withRepair := false
+	for _, arg := range args {
+		if arg == "--repair" {
+			withRepair = true
+		} else {
+			fmt.Fprintf(os.Stderr, "Unrecognized argument: %s\n", arg)
+			os.Exit(255)
+		}
+	}
+
+	healthy := plugins.Doctor(withRepair)
+	plugins.CleanupRuntimeCache()
+	if !healthy {
+		os.Exit(1)
+	}
+}
+
+func commandFacts(args []string) {
+	for _, arg := range args {
+		fmt.Fprintf(os.Stderr, "Unrecognized argument: %s\n", arg)
+		os.Exit(255)
+	}
+
+	plugins.PrintFacts()
+	plugins.CleanupRuntimeCache()
+}
+
 func commandScan(entities []*plugins.Entity, options map[int]bool) {
 	isShort := options[optionScanShort]
 	for _, entity := range entities {
@@ -166,13 +281,16 @@ func commandScan(entities []*plugins.Entity, options map[int]bool) {
 }
 
 func commandDiff(entities []*plugins.Entity, options map[int]bool) {
-	for _, entity := range entities {
-		output, err := entity.RenderDiff()
+	style := plugins.DiffStyle{
+		Color:    options[optionDiffColor],
+		WordDiff: options[optionDiffWordDiff],
+	}
+	plugins.RenderDiffs(entities, func(entity *plugins.Entity, output []byte, err error) {
 		if err != nil {
 			report := plugins.Report{Action: "diff", Target: entity.EntityID()}
 			report.AddError(err.Error())
 			report.Print()
 		}
-		os.Stdout.Write(output)
-	}
+		os.Stdout.Write(style.Render(output))
+	})
 }
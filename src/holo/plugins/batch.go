@@ -0,0 +1,139 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package plugins
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+//ApplyEntities performs the application algorithm for all given entities, in
+//order. Consecutive entities that belong to the same plugin are applied with a
+//single "apply-many" operation if the plugin supports it.
+func ApplyEntities(entities []*Entity, withForce, withMerge bool) {
+	for _, batch := range splitIntoBatches(entities, "apply-many") {
+		if len(batch) == 1 {
+			batch[0].Apply(withForce, withMerge)
+			continue
+		}
+
+		command := batch[0].applyOperation(withForce, withMerge) + "-many"
+		//like in Entity.Apply(), stdout and stderr are collected in the same
+		//buffer to preserve their relative order
+		var output bytes.Buffer
+		messages, err := batch[0].plugin.RunWithMessages(batchArguments(command, batch), &output, &output)
+
+		notChanged := make(map[string]bool)
+		for _, message := range messages {
+			if strings.HasPrefix(message, "not changed ") {
+				notChanged[strings.TrimPrefix(message, "not changed ")] = true
+			}
+		}
+
+		chunks, started := splitBatchOutput(output.Bytes(), batch)
+		for idx, entity := range batch {
+			entity.printApplyResult(chunks[idx], notChanged[entity.id], batchError(err, idx, started))
+		}
+	}
+}
+
+//RenderDiffs renders the diffs for all given entities, in order, and passes
+//each result to the given callback. Consecutive entities that belong to the
+//same plugin are handled by a single "diff-many" operation if the plugin
+//supports it.
+func RenderDiffs(entities []*Entity, callback func(entity *Entity, output []byte, err error)) {
+	for _, batch := range splitIntoBatches(entities, "diff-many") {
+		if len(batch) == 1 {
+			output, err := batch[0].RenderDiff()
+			callback(batch[0], output, err)
+			continue
+		}
+
+		var stdout, stderr bytes.Buffer
+		err := batch[0].plugin.Command(batchArguments("diff-many", batch), &stdout, &stderr, nil).Run()
+
+		//print error output before each diff, like it would appear if the
+		//plugin had been called once per entity
+		stdoutChunks, started := splitBatchOutput(stdout.Bytes(), batch)
+		stderrChunks, _ := splitBatchOutput(stderr.Bytes(), batch)
+		for idx, entity := range batch {
+			os.Stderr.Write(stderrChunks[idx])
+			callback(entity, stdoutChunks[idx], batchError(err, idx, started))
+		}
+	}
+}
+
+//splitIntoBatches groups consecutive entities of the same plugin, if that
+//plugin supports the given batch operation.
+func splitIntoBatches(entities []*Entity, operation string) [][]*Entity {
+	var batches [][]*Entity
+	for _, entity := range entities {
+		last := len(batches) - 1
+		if last >= 0 && batches[last][0].plugin == entity.plugin && entity.plugin.Supports(operation) {
+			batches[last] = append(batches[last], entity)
+		} else {
+			batches = append(batches, []*Entity{entity})
+		}
+	}
+	return batches
+}
+
+func batchArguments(command string, batch []*Entity) []string {
+	args := []string{command}
+	for _, entity := range batch {
+		args = append(args, entity.id)
+	}
+	return args
+}
+
+//splitBatchOutput splits the output of a batch operation at the "ENTITY: $ID"
+//lines that the plugin prints before working on each entity. The second
+//return value counts how many entities the plugin has started to work on.
+func splitBatchOutput(output []byte, batch []*Entity) (chunks [][]byte, started int) {
+	chunks = make([][]byte, len(batch))
+	current := 0
+	for _, line := range bytes.SplitAfter(output, []byte("\n")) {
+		//markers are only accepted as whole lines, and in the order of the
+		//entity arguments, so that stray output cannot mess up the assignment
+		text := string(bytes.TrimSuffix(line, []byte("\n")))
+		switch {
+		case started < len(batch) && text == "ENTITY: "+batch[started].id:
+			current = started
+			started++
+		case started > 0 && text == "ENTITY: "+batch[current].id:
+			//the marker was printed on both stdout and stderr
+		default:
+			chunks[current] = append(chunks[current], line...)
+		}
+	}
+	return chunks, started
+}
+
+//batchError decides which entities of a batch are affected when the batch
+//operation failed: the entity that was being worked on when the plugin exited,
+//and all entities that it did not get to.
+func batchError(err error, idx, started int) error {
+	if err != nil && idx >= started-1 {
+		return err
+	}
+	return nil
+}
@@ -59,34 +59,14 @@ func ReadConfiguration() *Configuration {
 		return nil
 	}
 
-	var result Configuration
-	lines := strings.SplitN(strings.TrimSpace(string(contents)), "\n", -1)
-	for _, line := range lines {
-		//ignore comments and empty lines
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
-		}
-
-		//collect plugin IDs
-		if strings.HasPrefix(line, "plugin ") {
-			pluginID := strings.TrimSpace(strings.TrimPrefix(line, "plugin"))
-			if strings.Contains(pluginID, "=") {
-				fields := strings.SplitN(pluginID, "=", 2)
-				result.Plugins = append(result.Plugins,
-					NewPluginWithExecutablePath(fields[0], fields[1]),
-				)
-			} else {
-				result.Plugins = append(result.Plugins, NewPlugin(pluginID))
-			}
-			continue
-		} else {
-			//unknown line
-			r := Report{Action: "read", Target: path}
+	result, unknownLines := parseConfiguration(contents)
+	if len(unknownLines) > 0 {
+		r := Report{Action: "read", Target: path}
+		for _, line := range unknownLines {
 			r.AddError("unknown command: %s", line)
-			r.Print()
-			return nil
 		}
+		r.Print()
+		return nil
 	}
 
 	//check existence of resource directories
@@ -125,5 +105,35 @@ func ReadConfiguration() *Configuration {
 		return nil
 	}
 
-	return &result
+	return result
+}
+
+//parseConfiguration parses the contents of /etc/holorc. Lines that cannot be
+//parsed are returned in the second return value.
+func parseConfiguration(contents []byte) (result *Configuration, unknownLines []string) {
+	result = &Configuration{}
+	lines := strings.SplitN(strings.TrimSpace(string(contents)), "\n", -1)
+	for _, line := range lines {
+		//ignore comments and empty lines
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		//collect plugin IDs
+		if strings.HasPrefix(line, "plugin ") {
+			pluginID := strings.TrimSpace(strings.TrimPrefix(line, "plugin"))
+			if strings.Contains(pluginID, "=") {
+				fields := strings.SplitN(pluginID, "=", 2)
+				result.Plugins = append(result.Plugins,
+					NewPluginWithExecutablePath(fields[0], fields[1]),
+				)
+			} else {
+				result.Plugins = append(result.Plugins, NewPlugin(pluginID))
+			}
+		} else {
+			unknownLines = append(unknownLines, line)
+		}
+	}
+	return result, unknownLines
 }
@@ -0,0 +1,225 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package plugins
+
+import (
+	"bytes"
+	"strings"
+)
+
+//DiffStyle describes how the "diff" operation renders the unified diffs that
+//the plugins produce.
+type DiffStyle struct {
+	//Color highlights removed and added lines (or words) with ANSI colors.
+	Color bool
+	//WordDiff shows changes within lines as "[-removed-]{+added+}" words
+	//instead of removed and added lines, similar to `git diff --word-diff`.
+	WordDiff bool
+}
+
+//Render applies this style to the given unified diff.
+func (s DiffStyle) Render(diff []byte) []byte {
+	if !s.Color && !s.WordDiff {
+		return diff
+	}
+
+	var out bytes.Buffer
+	var removed, added []string
+	inHunk := false
+	for _, line := range strings.SplitAfter(string(diff), "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		if text == "" && line == "" {
+			continue
+		}
+
+		//collect removed and added lines for the word diff
+		if s.WordDiff && inHunk {
+			switch {
+			case strings.HasPrefix(text, "-"):
+				removed = append(removed, text[1:])
+				continue
+			case strings.HasPrefix(text, "+"):
+				added = append(added, text[1:])
+				continue
+			case strings.HasPrefix(text, `\`):
+				//"\ No newline at end of file" has no meaning in a word diff
+				continue
+			}
+			s.writeWordDiff(&out, removed, added)
+			removed, added = nil, nil
+		}
+
+		switch {
+		case strings.HasPrefix(text, "diff "):
+			//a new file header starts
+			inHunk = false
+			s.writeLine(&out, "1", text)
+		case strings.HasPrefix(text, "@@"):
+			inHunk = true
+			s.writeLine(&out, "36", text)
+		case !inHunk:
+			s.writeLine(&out, "1", text)
+		case s.WordDiff && strings.HasPrefix(text, " "):
+			out.WriteString(text[1:] + "\n")
+		case strings.HasPrefix(text, "-"):
+			s.writeLine(&out, "31", text)
+		case strings.HasPrefix(text, "+"):
+			s.writeLine(&out, "32", text)
+		default:
+			out.WriteString(text + "\n")
+		}
+	}
+	s.writeWordDiff(&out, removed, added)
+	return out.Bytes()
+}
+
+//writeLine writes a line of the diff in the given color (if colors are enabled).
+func (s DiffStyle) writeLine(out *bytes.Buffer, color, text string) {
+	if s.Color {
+		out.WriteString("\x1b[" + color + "m" + text + "\x1b[0m\n")
+	} else {
+		out.WriteString(text + "\n")
+	}
+}
+
+//writeWordDiff renders a block of removed and added lines as a word diff.
+func (s DiffStyle) writeWordDiff(out *bytes.Buffer, removed, added []string) {
+	if len(removed) == 0 && len(added) == 0 {
+		return
+	}
+	words := diffWords(
+		splitWords(strings.Join(removed, "\n")),
+		splitWords(strings.Join(added, "\n")),
+	)
+
+	//the markers for removed and added words
+	openMarker := map[byte]string{'-': "[-", '+': "{+"}
+	closeMarker := map[byte]string{'-': "-]", '+': "+}"}
+	if s.Color {
+		openMarker = map[byte]string{'-': "\x1b[31m", '+': "\x1b[32m"}
+		closeMarker = map[byte]string{'-': "\x1b[0m", '+': "\x1b[0m"}
+	}
+
+	var current byte = ' '
+	for _, word := range words {
+		//close the current run of removed/added words if necessary
+		if current != ' ' && (word.kind != current || word.text == "\n") {
+			out.WriteString(closeMarker[current])
+			current = ' '
+		}
+		if word.text == "\n" {
+			out.WriteString("\n")
+			continue
+		}
+		if word.kind != current {
+			out.WriteString(openMarker[word.kind])
+			current = word.kind
+		}
+		out.WriteString(word.text)
+	}
+	if current != ' ' {
+		out.WriteString(closeMarker[current])
+	}
+	out.WriteString("\n")
+}
+
+//diffWord is a word in a word diff. The kind is ' ' for unchanged words, '-'
+//for removed words and '+' for added words.
+type diffWord struct {
+	kind byte
+	text string
+}
+
+//splitWords splits text into words, runs of whitespace, and line breaks.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	for idx := 1; idx <= len(text); idx++ {
+		if idx == len(text) || wordClass(text[idx]) != wordClass(text[idx-1]) || text[idx] == '\n' {
+			words = append(words, text[start:idx])
+			start = idx
+		}
+	}
+	return words
+}
+
+func wordClass(c byte) int {
+	switch c {
+	case '\n':
+		return 0
+	case ' ', '\t':
+		return 1
+	default:
+		return 2
+	}
+}
+
+//diffWords finds the longest common subsequence of the two word lists, and
+//returns the corresponding word diff (removed words before added words).
+func diffWords(a, b []string) []diffWord {
+	//for very long blocks, don't bother looking for common words
+	if len(a)*len(b) > 1000000 {
+		var result []diffWord
+		for _, word := range a {
+			result = append(result, diffWord{'-', word})
+		}
+		for _, word := range b {
+			result = append(result, diffWord{'+', word})
+		}
+		return result
+	}
+
+	//lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var result, added []diffWord
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			result = append(append(result, added...), diffWord{' ', a[i]})
+			added = nil
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			result = append(result, diffWord{'-', a[i]})
+			i++
+		default:
+			added = append(added, diffWord{'+', b[j]})
+			j++
+		}
+	}
+	return append(result, added...)
+}
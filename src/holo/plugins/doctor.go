@@ -0,0 +1,158 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package plugins
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Doctor checks the Holo installation and the state of all plugins for
+//consistency, and prints a report for each problem found. If withRepair is
+//true, problems that can be repaired safely will be repaired. The return
+//value is false if any unrepaired problems remain.
+func Doctor(withRepair bool) (healthy bool) {
+	healthy = true
+
+	//check holorc (unlike ReadConfiguration, report all problems instead of
+	//giving up at the first one)
+	path := filepath.Join(RootDirectory(), "etc/holorc")
+	r := Report{Action: "Checking", Target: path}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.AddError(err.Error())
+		r.Print()
+		return false
+	}
+	config, unknownLines := parseConfiguration(contents)
+	for _, line := range unknownLines {
+		r.AddError("unknown command: %s", line)
+		healthy = false
+	}
+	r.PrintUnlessEmpty()
+
+	for _, plugin := range config.Plugins {
+		if !plugin.checkInstallation(withRepair) {
+			healthy = false
+			continue
+		}
+		if !plugin.runDoctorOperation(withRepair) {
+			healthy = false
+		}
+	}
+
+	return healthy
+}
+
+//checkInstallation checks that the plugin executable and the plugin's
+//directories are in place.
+func (p *Plugin) checkInstallation(withRepair bool) (healthy bool) {
+	healthy = true
+	r := Report{Action: "Checking", Target: "plugin " + p.id}
+	defer r.PrintUnlessEmpty()
+
+	info, err := os.Stat(p.executablePath)
+	switch {
+	case err != nil:
+		r.AddError("cannot find plugin executable: %s", err.Error())
+		healthy = false
+	case !info.Mode().IsRegular():
+		r.AddError("plugin executable %s is not a regular file", p.executablePath)
+		healthy = false
+	case info.Mode()&0111 == 0:
+		if withRepair {
+			//set the executable bits wherever the read bits are set
+			mode := info.Mode() | (info.Mode()&0444)>>2
+			err := os.Chmod(p.executablePath, mode)
+			if err != nil {
+				r.AddError(err.Error())
+				healthy = false
+			} else {
+				r.AddWarning("made %s executable (mode is now %s)", p.executablePath, mode)
+			}
+		} else {
+			r.AddError("plugin executable %s is not executable (use --repair to fix)", p.executablePath)
+			healthy = false
+		}
+	}
+
+	dir := p.ResourceDirectory()
+	info, err = os.Stat(dir)
+	switch {
+	case err != nil:
+		r.AddError("Cannot open %s: %s", dir, err.Error())
+		healthy = false
+	case !info.IsDir():
+		r.AddError("Cannot open %s: not a directory!", dir)
+		healthy = false
+	}
+
+	//the cache directory is needed for running the plugin afterwards
+	if healthy {
+		for _, dir := range []string{p.CacheDirectory(), p.StateDirectory()} {
+			err := os.MkdirAll(dir, 0755)
+			if err != nil {
+				r.AddError(err.Error())
+				healthy = false
+			}
+		}
+	}
+
+	return healthy
+}
+
+//runDoctorOperation runs the plugin's optional "doctor" operation, if the
+//plugin supports it.
+func (p *Plugin) runDoctorOperation(withRepair bool) (healthy bool) {
+	//a scan is required to find out whether the plugin supports the operation
+	if p.Scan() == nil {
+		return false
+	}
+	if !p.Supports("doctor") {
+		return true
+	}
+
+	args := []string{"doctor"}
+	if withRepair {
+		args = append(args, "--repair")
+	}
+	var output bytes.Buffer
+	messages, err := p.RunWithMessages(args, &output, &output)
+
+	healthy = err == nil
+	for _, message := range messages {
+		if message == "problems found" {
+			healthy = false
+		}
+	}
+
+	if output.Len() > 0 || err != nil {
+		r := Report{Action: "Checking", Target: "plugin " + p.id}
+		if err != nil {
+			r.AddError(err.Error())
+		}
+		r.AddLog(output.String())
+		r.Print()
+	}
+	return healthy
+}
@@ -23,7 +23,6 @@ package plugins
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 )
 
@@ -55,86 +54,118 @@ func (e *Entity) Report() *Report {
 }
 
 //Apply performs the complete application algorithm for the given Entity.
-func (e *Entity) Apply(withForce bool) {
-	err := e.doApply(withForce)
-	if err != nil {
-		fmt.Printf("\x1b[31m\x1b[1m!!\x1b[0m %s\n\n", err.Error())
-	}
-}
-
-func (e *Entity) printApplyReport() {
-	r := e.Report()
-	r.Action = e.actionVerb
-	r.Print()
-}
-
-func (e *Entity) doApply(withForce bool) error {
-	command := "apply"
-	if withForce {
-		command = "force-apply"
-	}
-
-	//the command channel (file descriptor 3 on the side of the plugin) can
-	//only be set up with an *os.File instance, so use a pipe that the plugin
-	//writes into and that we read from
-	cmdReader, cmdWriterForPlugin, err := os.Pipe()
-	if err != nil {
-		e.printApplyReport()
-		return err
-	}
+func (e *Entity) Apply(withForce, withMerge bool) {
+	command := e.applyOperation(withForce, withMerge)
 
 	//TODO: This implementation is stupid and buffers all the output before
 	//deciding what to print and how. Technically we could just patch stdout
 	//and stderr through directly, but there is a caveat: We always want the
 	//scan report in front of all output.
 	var output bytes.Buffer
-	cmd := e.plugin.Command([]string{command, e.id}, &output, &output, cmdWriterForPlugin)
-	err = cmd.Start() //cannot use Run() since we need to read from the pipe before the plugin exits
-	if err != nil {
-		e.printApplyReport()
-		return err
-	}
+	messages, err := e.plugin.RunWithMessages([]string{command, e.id}, &output, &output)
 
-	cmdWriterForPlugin.Close() //or next line will block (see Plugin.Command docs)
-	cmdBytes, err := ioutil.ReadAll(cmdReader)
-	if err != nil {
-		e.printApplyReport()
-		return err
+	notChanged := false
+	for _, message := range messages {
+		if message == "not changed" {
+			notChanged = true
+		}
 	}
-	err = cmdReader.Close()
-	if err != nil {
-		e.printApplyReport()
-		return err
+	e.printApplyResult(output.Bytes(), notChanged, err)
+}
+
+//applyOperation returns the plugin operation that applies this Entity. The
+//"merge-apply" operation is only used if the plugin supports it.
+func (e *Entity) applyOperation(withForce, withMerge bool) string {
+	switch {
+	case withForce:
+		return "force-apply"
+	case withMerge && e.plugin.Supports("merge-apply"):
+		return "merge-apply"
+	default:
+		return "apply"
 	}
-	err = cmd.Wait()
+}
 
+func (e *Entity) printApplyResult(output []byte, notChanged bool, err error) {
 	//only print report if there was output, or if the plugin provisioned the
 	//entity (as signaled by the absence of the "not changed\n" command")
-	showReport := true
-	if output.Len() == 0 && err == nil {
-		cmdLines := bytes.Split(cmdBytes, []byte("\n"))
-		for _, line := range cmdLines {
-			if string(line) == "not changed" {
-				showReport = false
-			}
-		}
-	}
-	if showReport {
-		e.printApplyReport()
+	if len(output) > 0 || err != nil || !notChanged {
+		e.printReport(e.actionVerb)
 	}
+	e.printOutput(output, err)
+}
+
+func (e *Entity) printReport(action string) {
+	r := e.Report()
+	r.Action = action
+	r.Print()
+}
 
+func (e *Entity) printOutput(output []byte, err error) {
 	//if output was written, insert an empty line to preserve our own paragraph layout
-	if output.Len() > 0 {
-		outputBytes := output.Bytes()
-		os.Stdout.Write(outputBytes)
-		if bytes.HasSuffix(outputBytes, []byte("\n")) {
+	if len(output) > 0 {
+		os.Stdout.Write(output)
+		if bytes.HasSuffix(output, []byte("\n")) {
 			os.Stdout.Write([]byte("\n"))
 		} else {
 			os.Stdout.Write([]byte("\n\n"))
 		}
 	}
 
-	return err
+	if err != nil {
+		fmt.Printf("\x1b[31m\x1b[1m!!\x1b[0m %s\n\n", err.Error())
+	}
+}
+
+//Adopt records the current state of this Entity as its provisioned state. If
+//exportDir is not empty, the plugin also writes a repository entry into it
+//that reproduces the current state (as a patch, if asPatch is true).
+func (e *Entity) Adopt(exportDir string, asPatch bool) {
+	if !e.plugin.Supports("adopt") {
+		e.printReport("Adopting")
+		e.printOutput(nil, fmt.Errorf("plugin %s does not support adopting entities", e.plugin.ID()))
+		return
+	}
+
+	args := []string{"adopt"}
+	if exportDir != "" {
+		args = append(args, "--export="+exportDir)
+	}
+	if asPatch {
+		args = append(args, "--patch")
+	}
+	args = append(args, e.id)
+
+	//like in Apply(), stdout and stderr are collected in the same buffer to
+	//preserve their relative order
+	var output bytes.Buffer
+	err := e.plugin.Command(args, &output, &output, nil).Run()
+	e.printReport("Adopting")
+	e.printOutput(output.Bytes(), err)
+}
+
+//Rollback restores an earlier generation of this Entity and records it as its
+//provisioned state. If generation is empty, the plugin chooses the generation
+//before the current one.
+func (e *Entity) Rollback(generation string) {
+	if !e.plugin.Supports("rollback") {
+		e.printReport("Rolling back")
+		e.printOutput(nil, fmt.Errorf("plugin %s does not support rolling back entities", e.plugin.ID()))
+		return
+	}
+
+	args := []string{"rollback"}
+	if generation != "" {
+		args = append(args, "--to="+generation)
+	}
+	args = append(args, e.id)
+
+	//like in Apply(), stdout and stderr are collected in the same buffer to
+	//preserve their relative order
+	var output bytes.Buffer
+	err := e.plugin.Command(args, &output, &output, nil).Run()
+	e.printReport("Rolling back")
+	e.printOutput(output.Bytes(), err)
 }
 
 //RenderDiff creates a unified diff between the current and last
@@ -0,0 +1,298 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var facts map[string]string
+
+//factNameRx matches valid fact names. Fact names must be usable as the suffix
+//of an environment variable name.
+var factNameRx = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+//Facts returns the facts about the host system. The facts are collected on
+//the first call (i.e. only when they are needed), and the same facts are
+//returned for the rest of this run.
+func Facts() map[string]string {
+	if facts == nil {
+		facts = collectFacts()
+	}
+	return facts
+}
+
+//FactsPath returns the path to the JSON file containing the facts, which is
+//published to plugins in the $HOLO_FACTS_FILE environment variable.
+func FactsPath() string {
+	return filepath.Join(CachePath(), "facts.json")
+}
+
+//FactsDirectory returns the path to the directory containing executables for
+//custom facts.
+func FactsDirectory() string {
+	return filepath.Join(RootDirectory(), "etc/holo/facts.d")
+}
+
+//factsEnvironment returns the HOLO_FACTS_FILE and HOLO_FACT_* environment
+//variables for plugin executables.
+func factsEnvironment() []string {
+	f := Facts()
+	env := []string{"HOLO_FACTS_FILE=" + normalizePath(FactsPath())}
+	for _, name := range sortedFactNames(f) {
+		env = append(env, "HOLO_FACT_"+strings.ToUpper(name)+"="+f[name])
+	}
+	return env
+}
+
+func collectFacts() map[string]string {
+	result := make(map[string]string)
+
+	//prefer the files in the root directory (this also gives stable results
+	//in test runs)
+	if hostname := readFactFile("etc/hostname"); hostname != "" {
+		result["hostname"] = hostname
+	} else if hostname, err := os.Hostname(); err == nil {
+		result["hostname"] = hostname
+	}
+	if machineID := readFactFile("etc/machine-id"); machineID != "" {
+		result["machine_id"] = machineID
+	}
+
+	osRelease := readOSRelease()
+	if value := os.Getenv("HOLO_CURRENT_DISTRIBUTION"); value != "" {
+		//unit test override (see holo-files)
+		result["distribution"] = value
+	} else if osRelease["ID"] != "" {
+		ids := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+		sort.Strings(ids)
+		result["distribution"] = strings.Join(ids, " ")
+	}
+	if osRelease["VERSION_ID"] != "" {
+		result["distribution_version"] = osRelease["VERSION_ID"]
+	}
+
+	result["cpu_count"] = strconv.Itoa(runtime.NumCPU())
+	if memory := readMemoryTotal(); memory != "" {
+		result["memory_total"] = memory
+	}
+
+	interfaces, addresses := readNetworkInterfaces()
+	result["network_interfaces"] = strings.Join(interfaces, " ")
+	result["ip_addresses"] = strings.Join(addresses, " ")
+
+	//custom facts override builtin facts
+	for name, value := range collectCustomFacts() {
+		result[name] = value
+	}
+
+	//publish facts to plugins
+	err := writeFactsFile(result)
+	if err != nil {
+		r := Report{Action: "write", Target: FactsPath()}
+		r.AddError(err.Error())
+		r.Print()
+	}
+
+	return result
+}
+
+func readFactFile(relPath string) string {
+	contents, err := ioutil.ReadFile(filepath.Join(RootDirectory(), relPath))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+//readOSRelease parses os-release(5) (a harshly limited subset of shell script).
+func readOSRelease() map[string]string {
+	contents, err := ioutil.ReadFile(filepath.Join(RootDirectory(), "etc/os-release"))
+	if err != nil {
+		contents, err = ioutil.ReadFile(filepath.Join(RootDirectory(), "usr/lib/os-release"))
+	}
+	variables := make(map[string]string)
+	if err != nil {
+		return variables
+	}
+
+	escapeRx := regexp.MustCompile(`\\(.)`)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		//ignore comments
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		//line format is key=value
+		split := strings.SplitN(line, "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+		key, value := split[0], split[1]
+		//value may be enclosed in quotes
+		switch {
+		case strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\""):
+			value = strings.TrimPrefix(strings.TrimSuffix(value, "\""), "\"")
+		case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+			value = strings.TrimPrefix(strings.TrimSuffix(value, "'"), "'")
+		}
+		//special characters may be escaped
+		variables[key] = escapeRx.ReplaceAllString(value, "$1")
+	}
+	return variables
+}
+
+//readMemoryTotal returns the total amount of memory in bytes (from the proc
+//filesystem in the root directory, so it is omitted when there is none).
+func readMemoryTotal() string {
+	contents, err := ioutil.ReadFile(filepath.Join(RootDirectory(), "proc/meminfo"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		//line format is "MemTotal:       16314204 kB"
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kibibytes, err := strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				return strconv.FormatUint(kibibytes*1024, 10)
+			}
+		}
+	}
+	return ""
+}
+
+//readNetworkInterfaces returns the names of all network interfaces, and the
+//IP addresses of all interfaces except for loopback interfaces. (Unlike the
+//other facts, these cannot be read from the root directory, so they always
+//describe the system that holo runs on.)
+func readNetworkInterfaces() (names []string, addresses []string) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil
+	}
+	for _, iface := range interfaces {
+		names = append(names, iface.Name)
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				addresses = append(addresses, ipnet.IP.String())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, addresses
+}
+
+//collectCustomFacts runs the executables in the facts directory. Each of them
+//prints facts on stdout, one per line in the form "name=value".
+func collectCustomFacts() map[string]string {
+	result := make(map[string]string)
+
+	paths, err := filepath.Glob(filepath.Join(FactsDirectory(), "*"))
+	if err != nil {
+		return result
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		r := Report{Action: "Collecting facts from", Target: path}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(path)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if stderr.Len() > 0 {
+			r.AddWarning("%s", strings.TrimSpace(stderr.String()))
+		}
+		if err != nil {
+			r.AddError("execution failed: %s", err.Error())
+			r.Print()
+			continue
+		}
+
+		scanner := bufio.NewScanner(&stdout)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			split := strings.SplitN(line, "=", 2)
+			if len(split) != 2 || !factNameRx.MatchString(split[0]) {
+				r.AddError("invalid fact: %s", line)
+				continue
+			}
+			result[split[0]] = split[1]
+		}
+		r.PrintUnlessEmpty()
+	}
+
+	return result
+}
+
+func writeFactsFile(f map[string]string) error {
+	contents, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(FactsPath(), append(contents, '\n'), 0644)
+}
+
+func sortedFactNames(f map[string]string) []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//PrintFacts prints all facts on stdout, one per line in the form "name=value".
+func PrintFacts() {
+	f := Facts()
+	for _, name := range sortedFactNames(f) {
+		fmt.Printf("%s=%s\n", name, f[name])
+	}
+}
@@ -21,7 +21,9 @@
 package plugins
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -32,19 +34,21 @@ import (
 type Plugin struct {
 	id             string
 	executablePath string
+	//optional operations that the plugin announced during the scan operation
+	supportedOperations map[string]bool
 }
 
 //NewPlugin creates a new Plugin.
 func NewPlugin(id string) *Plugin {
 	executablePath := filepath.Join(RootDirectory(), "usr/lib/holo/holo-"+id)
-	return &Plugin{id, executablePath}
+	return &Plugin{id: id, executablePath: executablePath}
 }
 
 //NewPluginWithExecutablePath creates a new Plugin whose executable resides in
 //a non-standard location. (This is used exclusively for testing plugins before
 //they are installed.)
 func NewPluginWithExecutablePath(id string, executablePath string) *Plugin {
-	return &Plugin{id, executablePath}
+	return &Plugin{id: id, executablePath: executablePath}
 }
 
 //ID returns the plugin ID.
@@ -93,11 +97,74 @@ func (p *Plugin) Command(arguments []string, stdout io.Writer, stderr io.Writer,
 	env = append(env, "HOLO_CACHE_DIR="+normalizePath(p.CacheDirectory()))
 	env = append(env, "HOLO_RESOURCE_DIR="+normalizePath(p.ResourceDirectory()))
 	env = append(env, "HOLO_STATE_DIR="+normalizePath(p.StateDirectory()))
+	if len(arguments) > 0 && operationUsesFacts(arguments[0]) {
+		env = append(env, factsEnvironment()...)
+	}
 	cmd.Env = env
 
 	return cmd
 }
 
+//operationUsesFacts returns whether the given plugin operation needs the facts
+//about the host system. For read-only operations like scan and diff, the facts
+//are not published, so the custom fact executables are only run by holo when
+//entities are actually provisioned.
+func operationUsesFacts(operation string) bool {
+	switch strings.TrimSuffix(operation, "-many") {
+	case "info", "scan", "diff", "doctor":
+		return false
+	default:
+		return true
+	}
+}
+
+//RunWithMessages runs the plugin with the given arguments like Command(),
+//and returns the lines that the plugin wrote into file descriptor 3.
+func (p *Plugin) RunWithMessages(arguments []string, stdout io.Writer, stderr io.Writer) (messages []string, err error) {
+	//the command channel (file descriptor 3 on the side of the plugin) can
+	//only be set up with an *os.File instance, so use a pipe that the plugin
+	//writes into and that we read from
+	msgReader, msgWriterForPlugin, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := p.Command(arguments, stdout, stderr, msgWriterForPlugin)
+	//cannot use Run() since we need to read from the pipe before the plugin exits
+	err = cmd.Start()
+	//close our copy of the write end, or the read below will block forever
+	msgWriterForPlugin.Close()
+	if err != nil {
+		msgReader.Close()
+		return nil, err
+	}
+
+	msgBytes, err := ioutil.ReadAll(msgReader)
+	if err != nil {
+		msgReader.Close()
+		cmd.Wait()
+		return nil, err
+	}
+	err = msgReader.Close()
+	if err != nil {
+		cmd.Wait()
+		return nil, err
+	}
+
+	for _, line := range bytes.Split(msgBytes, []byte("\n")) {
+		if len(line) > 0 {
+			messages = append(messages, string(line))
+		}
+	}
+	return messages, cmd.Wait()
+}
+
+//Supports returns whether the plugin announced support for the given optional
+//operation during the scan operation (see holo-plugin-interface(7)).
+func (p *Plugin) Supports(operation string) bool {
+	return p.supportedOperations[operation]
+}
+
 //For reproducibility in tests.
 func normalizePath(path string) string {
 	if path == "/" {
@@ -118,7 +118,15 @@ func (p *Plugin) Scan() []*Entity {
 
 func (p *Plugin) runScanOperation() (stdout string, hadError bool) {
 	var stdoutBuffer, stderrBuffer bytes.Buffer
-	err := p.Command([]string{"scan"}, &stdoutBuffer, &stderrBuffer, nil).Run()
+	messages, err := p.RunWithMessages([]string{"scan"}, &stdoutBuffer, &stderrBuffer)
+
+	//plugins announce optional operations as "supports $OPERATION"
+	p.supportedOperations = make(map[string]bool)
+	for _, message := range messages {
+		if strings.HasPrefix(message, "supports ") {
+			p.supportedOperations[strings.TrimPrefix(message, "supports ")] = true
+		}
+	}
 
 	//report any errors or error output
 	if err != nil || stderrBuffer.Len() > 0 {
@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var (
+	targetDirectory   string
+	resourceDirectory string
+	stateDirectory    string
+	cacheDirectory    string
+)
+
+func init() {
+	targetDirectory = strings.TrimSuffix(os.Getenv("HOLO_ROOT_DIR"), "/")
+	if targetDirectory == "" {
+		targetDirectory = "/"
+	}
+	resourceDirectory = strings.TrimSuffix(os.Getenv("HOLO_RESOURCE_DIR"), "/")
+	stateDirectory = strings.TrimSuffix(os.Getenv("HOLO_STATE_DIR"), "/")
+	cacheDirectory = strings.TrimSuffix(os.Getenv("HOLO_CACHE_DIR"), "/")
+}
+
+//TargetDirectory is $HOLO_ROOT_DIR (or "/" if not set). All paths of the
+//provisioned system should be resolved relative to this directory, so that the
+//plugin can be run against a test scenario.
+func TargetDirectory() string {
+	return targetDirectory
+}
+
+//ResourceDirectory is $HOLO_RESOURCE_DIR, the directory where the plugin finds
+//its entity definitions (usually /usr/share/holo/$PLUGIN_ID).
+func ResourceDirectory() string {
+	return resourceDirectory
+}
+
+//StateDirectory is $HOLO_STATE_DIR, the directory where the plugin may store
+//data persistently (usually /var/lib/holo/$PLUGIN_ID).
+func StateDirectory() string {
+	return stateDirectory
+}
+
+//CacheDirectory is $HOLO_CACHE_DIR, the directory where the plugin may store
+//data until holo exits.
+func CacheDirectory() string {
+	return cacheDirectory
+}
+
+var facts map[string]string
+
+//Facts returns the facts about the host system that holo collected (see
+//`holo facts`), as read from $HOLO_FACTS_FILE. If the plugin was not called
+//by holo, an empty map is returned.
+func Facts() map[string]string {
+	if facts == nil {
+		facts = make(map[string]string)
+		path := os.Getenv("HOLO_FACTS_FILE")
+		if path != "" {
+			contents, err := ioutil.ReadFile(path)
+			if err == nil {
+				_ = json.Unmarshal(contents, &facts)
+			}
+		}
+	}
+	return facts
+}
@@ -0,0 +1,404 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+//Package holo provides the scaffolding for Holo plugins written in Go. A plugin
+//implements the Plugin interface and calls Main() from its main function, which
+//takes care of the protocol described in holo-plugin-interface(7).
+package holo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//Entity is the interface that all entities known to a Plugin must implement.
+type Entity interface {
+	//EntityID returns a string that uniquely identifies the entity. This is how
+	//the entity can be addressed as a target in the argument list for "holo
+	//apply", so it should not contain whitespace or characters that have a
+	//special meaning on the shell.
+	EntityID() string
+	//Report returns the description of this entity for the "scan" operation.
+	Report() *EntityReport
+}
+
+//Plugin is the interface that Holo plugins implement to be run by Main().
+type Plugin interface {
+	//Scan returns all entities that this plugin can provision. If a fatal error
+	//is encountered, it shall be reported on stderr, and nil shall be returned.
+	//"No entities found" shall be reported as a non-nil empty slice.
+	Scan() []Entity
+	//Apply performs the complete application algorithm for the given entity,
+	//which is one of the entities returned by Scan(). Informational output
+	//shall be printed on stdout, errors on stderr. The return value shall be
+	//false if the entity was already in the desired state.
+	Apply(entity Entity, withForce bool) (entityHasChanged bool)
+	//Diff creates a unified diff between the current and the last provisioned
+	//version of the given entity.
+	Diff(entity Entity) ([]byte, error)
+}
+
+//CachingPlugin is an optional extension of the Plugin interface for plugins
+//whose Scan() is expensive. Main() calls StoreCache() at the end of the "scan"
+//operation, and uses LoadCache() instead of Scan() for all other operations.
+type CachingPlugin interface {
+	Plugin
+	//StoreCache persists the result of the scan operation below
+	//CacheDirectory().
+	StoreCache(entities []Entity) error
+	//LoadCache retrieves the entities stored by StoreCache(). If the cache is
+	//missing or stale, nil shall be returned to request a fresh Scan().
+	LoadCache() ([]Entity, error)
+}
+
+//DoctorPlugin is an optional extension of the Plugin interface for plugins
+//that can check their state for consistency (see "holo doctor").
+type DoctorPlugin interface {
+	Plugin
+	//Doctor checks the state of the given entities and of the plugin's state
+	//directory. Each problem found shall be reported on stdout. If withRepair
+	//is true, problems that can be repaired safely shall be repaired. The
+	//return value shall be false if unrepaired problems remain.
+	Doctor(entities []Entity, withRepair bool) (healthy bool)
+}
+
+//MergingPlugin is an optional extension of the Plugin interface for plugins
+//that can merge manual changes to an entity into its desired state (see
+//"holo apply --merge").
+type MergingPlugin interface {
+	Plugin
+	//ApplyWithMerge works like Apply, but if the entity was modified by the
+	//user, the user's changes shall be merged into the desired state instead of
+	//refusing to apply the entity.
+	ApplyWithMerge(entity Entity) (entityHasChanged bool)
+}
+
+//AdoptingPlugin is an optional extension of the Plugin interface for plugins
+//that can accept manual changes to an entity as its provisioned state (see
+//"holo adopt").
+type AdoptingPlugin interface {
+	Plugin
+	//Adopt records the current state of the entity as its provisioned state,
+	//so that it does not count as modified by the user anymore. If exportDir is
+	//not empty, a repository entry that reproduces the current state shall be
+	//written into it (as a patch, if asPatch is true, and if the plugin
+	//supports patches). Informational output shall be printed on stdout,
+	//errors on stderr.
+	Adopt(entity Entity, exportDir string, asPatch bool)
+}
+
+//RollbackPlugin is an optional extension of the Plugin interface for plugins
+//that keep earlier generations of their entities (see "holo rollback").
+type RollbackPlugin interface {
+	Plugin
+	//Rollback restores the given generation of the entity and records it as
+	//its provisioned state. If generation is 0, the generation before the
+	//current one shall be restored. Informational output shall be printed on
+	//stdout, errors on stderr.
+	Rollback(entity Entity, generation int)
+}
+
+//Main implements the plugin executable's main function. It checks the
+//runtime environment, dispatches the operation given in os.Args to the
+//plugin, and exits with non-zero exit code when a fatal error occurs.
+func Main(plugin Plugin) {
+	if version := os.Getenv("HOLO_API_VERSION"); version != "1" {
+		fmt.Fprintf(os.Stderr, "!! %s plugin called with unknown HOLO_API_VERSION %s\n", pluginName(), version)
+	}
+
+	//an operation must be given as first argument
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "!! %s plugin called without operation\n", pluginName())
+		os.Exit(1)
+	}
+	operation := os.Args[1]
+
+	//scan operation requires no arguments
+	if operation == "scan" {
+		os.Exit(runScanOperation(plugin))
+	}
+
+	//doctor operation requires no entity selection
+	if operation == "doctor" {
+		os.Exit(runDoctorOperation(plugin))
+	}
+
+	//adopt operation has its own options
+	if operation == "adopt" {
+		os.Exit(runAdoptOperation(plugin))
+	}
+
+	//rollback operation has its own options
+	if operation == "rollback" {
+		os.Exit(runRollbackOperation(plugin))
+	}
+
+	//check that it is a known operation
+	isBatch := false
+	switch operation {
+	case "apply", "force-apply", "diff":
+	case "apply-many", "force-apply-many", "diff-many":
+		isBatch = true
+	case "merge-apply", "merge-apply-many":
+		if _, ok := plugin.(MergingPlugin); !ok {
+			fmt.Fprintf(os.Stderr, "!! unknown operation \"%s\"\n", operation)
+			os.Exit(1)
+		}
+		isBatch = operation == "merge-apply-many"
+	default:
+		fmt.Fprintf(os.Stderr, "!! unknown operation \"%s\"\n", operation)
+		os.Exit(1)
+	}
+
+	//all other operations require an entity selection
+	entityIDs := os.Args[2:]
+	if len(entityIDs) == 0 || (len(entityIDs) > 1 && !isBatch) {
+		fmt.Fprintf(os.Stderr, "!! operation \"%s\" requires exactly one entity ID\n", operation)
+		os.Exit(1)
+	}
+	entities := loadEntities(plugin)
+	if entities == nil {
+		//some fatal error occurred - it was already reported, so just exit
+		os.Exit(1)
+	}
+	selectedEntities := make([]Entity, 0, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entity := FindEntity(entities, entityID)
+		if entity == nil {
+			fmt.Fprintf(os.Stderr, "!! unknown entity ID \"%s\"\n", entityID)
+			os.Exit(1)
+		}
+		selectedEntities = append(selectedEntities, entity)
+	}
+
+	if !isBatch {
+		runOperation(plugin, operation, selectedEntities[0], "not changed")
+		return
+	}
+	//in batch operations, mark the start of each entity's output on stdout
+	//and stderr, and tag messages with the entity ID
+	operation = strings.TrimSuffix(operation, "-many")
+	for _, entity := range selectedEntities {
+		fmt.Fprintf(os.Stdout, "ENTITY: %s\n", entity.EntityID())
+		fmt.Fprintf(os.Stderr, "ENTITY: %s\n", entity.EntityID())
+		runOperation(plugin, operation, entity, "not changed "+entity.EntityID())
+	}
+}
+
+//FindEntity returns the entity with the given ID, or nil if there is none.
+func FindEntity(entities []Entity, entityID string) Entity {
+	for _, entity := range entities {
+		if entity.EntityID() == entityID {
+			return entity
+		}
+	}
+	return nil
+}
+
+func runScanOperation(plugin Plugin) (exitCode int) {
+	//scan for entities
+	entities := plugin.Scan()
+	if entities == nil {
+		//some fatal error occurred - it was already reported, so just exit
+		return 1
+	}
+
+	//print reports
+	for _, entity := range entities {
+		entity.Report().Print()
+	}
+
+	//announce the batch operations implemented by Main() (this is optional,
+	//so errors are ignored, e.g. when holo did not open file descriptor 3)
+	_ = WriteMessage("supports apply-many")
+	_ = WriteMessage("supports diff-many")
+	if _, ok := plugin.(DoctorPlugin); ok {
+		_ = WriteMessage("supports doctor")
+	}
+	if _, ok := plugin.(MergingPlugin); ok {
+		_ = WriteMessage("supports merge-apply")
+	}
+	if _, ok := plugin.(AdoptingPlugin); ok {
+		_ = WriteMessage("supports adopt")
+	}
+	if _, ok := plugin.(RollbackPlugin); ok {
+		_ = WriteMessage("supports rollback")
+	}
+
+	//store scan result in cache
+	if cachingPlugin, ok := plugin.(CachingPlugin); ok {
+		err := cachingPlugin.StoreCache(entities)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+			return 1
+		}
+	}
+	return 0
+}
+
+func runDoctorOperation(plugin Plugin) (exitCode int) {
+	doctorPlugin, ok := plugin.(DoctorPlugin)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "!! unknown operation \"doctor\"\n")
+		return 1
+	}
+	withRepair := false
+	for _, arg := range os.Args[2:] {
+		if arg != "--repair" {
+			fmt.Fprintf(os.Stderr, "!! unrecognized argument for operation \"doctor\": %s\n", arg)
+			return 1
+		}
+		withRepair = true
+	}
+
+	entities := loadEntities(plugin)
+	if entities == nil {
+		return 1
+	}
+	if !doctorPlugin.Doctor(entities, withRepair) {
+		err := WriteMessage("problems found")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+		}
+	}
+	return 0
+}
+
+func runAdoptOperation(plugin Plugin) (exitCode int) {
+	adoptingPlugin, ok := plugin.(AdoptingPlugin)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "!! unknown operation \"adopt\"\n")
+		return 1
+	}
+	exportDir := ""
+	asPatch := false
+	var entityIDs []string
+	for _, arg := range os.Args[2:] {
+		switch {
+		case strings.HasPrefix(arg, "--export="):
+			exportDir = strings.TrimPrefix(arg, "--export=")
+		case arg == "--patch":
+			asPatch = true
+		default:
+			entityIDs = append(entityIDs, arg)
+		}
+	}
+	if len(entityIDs) != 1 {
+		fmt.Fprintf(os.Stderr, "!! operation \"adopt\" requires exactly one entity ID\n")
+		return 1
+	}
+
+	entities := loadEntities(plugin)
+	if entities == nil {
+		return 1
+	}
+	entity := FindEntity(entities, entityIDs[0])
+	if entity == nil {
+		fmt.Fprintf(os.Stderr, "!! unknown entity ID \"%s\"\n", entityIDs[0])
+		return 1
+	}
+	adoptingPlugin.Adopt(entity, exportDir, asPatch)
+	return 0
+}
+
+func runRollbackOperation(plugin Plugin) (exitCode int) {
+	rollbackPlugin, ok := plugin.(RollbackPlugin)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "!! unknown operation \"rollback\"\n")
+		return 1
+	}
+	generation := 0
+	var entityIDs []string
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--to=") {
+			value, err := strconv.Atoi(strings.TrimPrefix(arg, "--to="))
+			if err != nil || value < 1 {
+				fmt.Fprintf(os.Stderr, "!! invalid generation for operation \"rollback\": %s\n", arg)
+				return 1
+			}
+			generation = value
+		} else {
+			entityIDs = append(entityIDs, arg)
+		}
+	}
+	if len(entityIDs) != 1 {
+		fmt.Fprintf(os.Stderr, "!! operation \"rollback\" requires exactly one entity ID\n")
+		return 1
+	}
+
+	entities := loadEntities(plugin)
+	if entities == nil {
+		return 1
+	}
+	entity := FindEntity(entities, entityIDs[0])
+	if entity == nil {
+		fmt.Fprintf(os.Stderr, "!! unknown entity ID \"%s\"\n", entityIDs[0])
+		return 1
+	}
+	rollbackPlugin.Rollback(entity, generation)
+	return 0
+}
+
+func loadEntities(plugin Plugin) []Entity {
+	cachingPlugin, ok := plugin.(CachingPlugin)
+	if !ok {
+		return plugin.Scan()
+	}
+	entities, err := cachingPlugin.LoadCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+		return nil
+	}
+	if entities == nil {
+		return plugin.Scan()
+	}
+	return entities
+}
+
+func runOperation(plugin Plugin, operation string, entity Entity, notChangedMessage string) {
+	switch operation {
+	case "apply", "force-apply", "merge-apply":
+		var entityHasChanged bool
+		if operation == "merge-apply" {
+			entityHasChanged = plugin.(MergingPlugin).ApplyWithMerge(entity)
+		} else {
+			entityHasChanged = plugin.Apply(entity, operation == "force-apply")
+		}
+		if !entityHasChanged {
+			err := WriteMessage(notChangedMessage)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+			}
+		}
+	case "diff":
+		output, err := plugin.Diff(entity)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "!! %s\n", err.Error())
+		}
+		os.Stdout.Write(output)
+	}
+}
+
+func pluginName() string {
+	return filepath.Base(os.Args[0])
+}
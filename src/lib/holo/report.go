@@ -0,0 +1,74 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holo
+
+import (
+	"fmt"
+	"os"
+)
+
+//InfoLine is an "attribute: value" line in the scan report of an entity.
+type InfoLine struct {
+	Attribute string
+	Value     string
+}
+
+//EntityReport is the description of an entity that is printed by the "scan"
+//operation.
+type EntityReport struct {
+	//EntityID is the ID of the described entity.
+	EntityID string
+	//ActionVerb and ActionReason are only set when applying this entity will do
+	//something else than provisioning it (e.g. "Scrubbing").
+	ActionVerb   string
+	ActionReason string
+	//InfoLines are shown to the user, but not processed further by holo.
+	InfoLines []InfoLine
+}
+
+//AddInfo adds an information line to this EntityReport.
+func (r *EntityReport) AddInfo(attribute, value string) {
+	r.InfoLines = append(r.InfoLines, InfoLine{attribute, value})
+}
+
+//Print prints this report on stdout in the format required by the "scan"
+//operation.
+func (r *EntityReport) Print() {
+	fmt.Printf("ENTITY: %s\n", r.EntityID)
+	if r.ActionVerb != "" {
+		if r.ActionReason == "" {
+			fmt.Printf("ACTION: %s\n", r.ActionVerb)
+		} else {
+			fmt.Printf("ACTION: %s (%s)\n", r.ActionVerb, r.ActionReason)
+		}
+	}
+	for _, line := range r.InfoLines {
+		fmt.Printf("%s: %s\n", line.Attribute, line.Value)
+	}
+}
+
+//WriteMessage writes a message line to file descriptor 3, which holo opens as
+//a command channel during the "apply" operation (see
+//holo-plugin-interface(7)).
+func WriteMessage(message string) error {
+	_, err := os.NewFile(3, "file descriptor 3").Write([]byte(message + "\n"))
+	return err
+}
@@ -0,0 +1,3 @@
+#!/bin/sh
+echo datacenter=example-dc1
+echo rack=42
@@ -0,0 +1,4 @@
+#!/bin/sh
+echo rack=23
+echo "Invalid Fact=foo"
+echo "this is a warning" >&2
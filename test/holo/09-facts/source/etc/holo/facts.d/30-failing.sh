@@ -0,0 +1,3 @@
+#!/bin/sh
+echo never=seen
+exit 1
@@ -0,0 +1 @@
+export HOLO_CURRENT_DISTRIBUTION=gentoo
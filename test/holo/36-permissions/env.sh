@@ -0,0 +1,5 @@
+# simulate the modes from a previous run (the test harness resets all modes to 0644)
+chmod 0600 target/etc/drifted.conf
+chmod 0640 target/var/lib/holo/files/provisioned/etc/drifted.conf
+chmod 0640 target/etc/unchanged.conf
+chmod 0640 target/var/lib/holo/files/provisioned/etc/unchanged.conf
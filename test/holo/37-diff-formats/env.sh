@@ -0,0 +1,2 @@
+# the test harness resets all modes to 0644
+chmod 0755 target/etc/mode-change.conf
@@ -0,0 +1,4 @@
+# empty directories cannot be checked into Git, so create them here
+mkdir -p target/var/lib/holo/files/base/usr/lib/stale
+mkdir -p target/var/lib/holo/files/provisioned/etc/stale/nested
+mkdir -p target/var/lib/holo/files/provisioned/etc/managed/empty
@@ -0,0 +1,5 @@
+# simulate the modes from a previous run (the test harness resets all modes to
+# 0644, which is also the mode of the generations, since they were recorded
+# before the mode was set in the metadata)
+chmod 0600 target/etc/with-mode.conf
+chmod 0600 target/var/lib/holo/files/provisioned/etc/with-mode.conf
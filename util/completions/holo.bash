@@ -5,15 +5,27 @@ _holo() {
 
     if [ "$COMP_CWORD" = 1 ]; then
         # autocomplete first argument (either a command verb or --help/--version)
-        COMPREPLY=( $(compgen -W "--help --version apply diff scan" -- "$CURRENT_WORD") )
+        COMPREPLY=( $(compgen -W "--help --version adopt apply diff doctor facts rollback scan" -- "$CURRENT_WORD") )
+        return 0
+    elif [ "${COMP_WORDS[1]}" = "adopt" ]; then
+        # autocomplete for "holo adopt" - argument is either an entity or --export=/--patch
+        COMPREPLY=( $(compgen -W "$(holo scan --short) --export= --patch" -- "$CURRENT_WORD") )
         return 0
     elif [ "${COMP_WORDS[1]}" = "apply" ]; then
-        # autocomplete for "holo apply" - argument is either an entity or -f/--force
-        COMPREPLY=( $(compgen -W "$(holo scan --short) -f --force" -- "$CURRENT_WORD") )
+        # autocomplete for "holo apply" - argument is either an entity or -f/--force/--merge
+        COMPREPLY=( $(compgen -W "$(holo scan --short) -f --force --merge" -- "$CURRENT_WORD") )
         return 0
     elif [ "${COMP_WORDS[1]}" = "diff" ]; then
-        # autocomplete for "holo diff" - argument is an entity
-        COMPREPLY=( $(compgen -W "$(holo scan --short)" -- "$CURRENT_WORD") )
+        # autocomplete for "holo diff" - argument is either an entity or --color/--word-diff
+        COMPREPLY=( $(compgen -W "$(holo scan --short) --color --word-diff" -- "$CURRENT_WORD") )
+        return 0
+    elif [ "${COMP_WORDS[1]}" = "doctor" ]; then
+        # autocomplete for "holo doctor" - argument is --repair
+        COMPREPLY=( $(compgen -W "--repair" -- "$CURRENT_WORD") )
+        return 0
+    elif [ "${COMP_WORDS[1]}" = "rollback" ]; then
+        # autocomplete for "holo rollback" - argument is either an entity or --to=
+        COMPREPLY=( $(compgen -W "$(holo scan --short) --to=" -- "$CURRENT_WORD") )
         return 0
     elif [ "${COMP_WORDS[1]}" = "scan" ]; then
         # autocomplete for "holo scan" - argument is either an entity or -s/--short